@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// FillMode defines how buckets without data are filled
+type FillMode string
+
+const (
+	FillModeNull     FillMode = "null"
+	FillModePrevious FillMode = "previous"
+	FillModeValue    FillMode = "value"
+	FillModeLinear   FillMode = "linear"
+)
+
+// FillMissing is requested by the fill argument of $__timeGroup
+type FillMissing struct {
+	Mode FillMode
+
+	// Used by FillModeValue
+	Value float64
+
+	// Size of the time buckets
+	Interval time.Duration
+}
@@ -0,0 +1,38 @@
+package models
+
+// ResultLimits bound how much data is collected when following NextToken in one response
+type ResultLimits struct {
+	MaxRows        int64 `json:"maxRows,omitempty"`
+	MaxPages       int64 `json:"maxPages,omitempty"`
+	MaxResultBytes int64 `json:"maxResultBytes,omitempty"`
+}
+
+// Stricter returns the lowest configured value of each limit
+func (l ResultLimits) Stricter(other ResultLimits) ResultLimits {
+	return ResultLimits{
+		MaxRows:        stricterLimit(l.MaxRows, other.MaxRows),
+		MaxPages:       stricterLimit(l.MaxPages, other.MaxPages),
+		MaxResultBytes: stricterLimit(l.MaxResultBytes, other.MaxResultBytes),
+	}
+}
+
+// Exceeded returns a description of the first limit reached, or an empty string
+func (l ResultLimits) Exceeded(rows, pages, bytes int64) string {
+	switch {
+	case l.MaxRows > 0 && rows >= l.MaxRows:
+		return "max rows"
+	case l.MaxPages > 0 && pages >= l.MaxPages:
+		return "max pages"
+	case l.MaxResultBytes > 0 && bytes >= l.MaxResultBytes:
+		return "max result bytes"
+	}
+	return ""
+}
+
+// zero means no limit
+func stricterLimit(a, b int64) int64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
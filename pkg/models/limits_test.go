@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResultLimits(t *testing.T) {
+	ds := ResultLimits{MaxRows: 1000, MaxPages: 10}
+	query := ResultLimits{MaxRows: 100, MaxPages: 20, MaxResultBytes: 2048}
+
+	l := ds.Stricter(query)
+	if l != (ResultLimits{MaxRows: 100, MaxPages: 10, MaxResultBytes: 2048}) {
+		t.Fatalf("unexpected limits: %+v", l)
+	}
+	if ds.Stricter(ResultLimits{}) != ds {
+		t.Fatalf("empty limits should not change anything")
+	}
+
+	tests := []struct {
+		rows, pages, bytes int64
+		want               string
+	}{
+		{99, 9, 2047, ""},
+		{100, 1, 0, "max rows"},
+		{1, 10, 0, "max pages"},
+		{1, 1, 4096, "max result bytes"},
+	}
+	for _, tt := range tests {
+		if got := l.Exceeded(tt.rows, tt.pages, tt.bytes); got != tt.want {
+			t.Errorf("Exceeded(%d, %d, %d) = %q, want %q", tt.rows, tt.pages, tt.bytes, got, tt.want)
+		}
+	}
+	if got := (ResultLimits{}).Exceeded(1e9, 1e9, 1e9); got != "" {
+		t.Errorf("no limits should never be exceeded, got %q", got)
+	}
+}
+
+func TestResultLimits_QueryJSON(t *testing.T) {
+	q := QueryModel{}
+	if err := json.Unmarshal([]byte(`{"rawQuery":"SELECT 1","maxRows":5,"maxPages":2}`), &q); err != nil {
+		t.Fatalf("Error reading query: %s", err.Error())
+	}
+	if q.MaxRows != 5 || q.MaxPages != 2 {
+		t.Fatalf("invalid limits: %+v", q.ResultLimits)
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
 // TimestreamCustomMeta is the standard metadata
@@ -13,6 +14,51 @@ type TimestreamCustomMeta struct {
 	QueryID   string `json:"queryId,omitempty"`
 	RequestID string `json:"requestId,omitempty"`
 	HasSeries bool   `json:"hasSeries,omitempty"`
+	CacheHit  bool   `json:"cacheHit,omitempty"`
+	Retries   int    `json:"retries,omitempty"`
 
+	// Shared the execution of an identical query from another request
+	Deduplicated bool `json:"deduplicated,omitempty"`
+
+	// Status of the last page read
 	Status *timestreamquerytypes.QueryStatus `json:"status,omitempty"`
+
+	// Totals over every page read for this response
+	Stats *QueryStats `json:"stats,omitempty"`
+
+	// Channel streaming the remaining pages
+	Stream *StreamChannel `json:"stream,omitempty"`
+}
+
+// StreamChannel is a Grafana Live channel that follows the NextToken of a query.
+// Subscribers send Data with their subscription.
+type StreamChannel struct {
+	Path string `json:"path"`
+	Data string `json:"data"`
+}
+
+// QueryStats summarizes the pages read for one response
+type QueryStats struct {
+	BytesScanned int64 `json:"bytesScanned"`
+	BytesMetered int64 `json:"bytesMetered"`
+	Pages        int   `json:"pages"`
+	Rows         int   `json:"rows"`
+	DurationMs   int64 `json:"durationMs"`
+}
+
+// QueryStats converts the totals to the standard Grafana query stats
+func (s *QueryStats) QueryStats() []data.QueryStat {
+	stat := func(name string, unit string, value float64) data.QueryStat {
+		return data.QueryStat{
+			FieldConfig: data.FieldConfig{DisplayName: name, Unit: unit},
+			Value:       value,
+		}
+	}
+	return []data.QueryStat{
+		stat("Bytes scanned", "decbytes", float64(s.BytesScanned)),
+		stat("Bytes metered", "decbytes", float64(s.BytesMetered)),
+		stat("Pages", "none", float64(s.Pages)),
+		stat("Rows", "none", float64(s.Rows)),
+		stat("Execution time (Grafana server ⇆ Timestream)", "ms", float64(s.DurationMs)),
+	}
 }
@@ -0,0 +1,41 @@
+package models
+
+// ArrayMode is how ARRAY columns are returned
+type ArrayMode string
+
+const (
+	// ArrayModeDefault uses the array mode of the datasource, which is JSON when unset
+	ArrayModeDefault ArrayMode = ""
+	// ArrayModeJSON returns each array as JSON text
+	ArrayModeJSON ArrayMode = "json"
+	// ArrayModeRows returns a row for each element, like UNNEST
+	ArrayModeRows ArrayMode = "rows"
+	// ArrayModeFields returns a field for each index, for arrays of a fixed length
+	ArrayModeFields ArrayMode = "fields"
+)
+
+// ResultOptions change how the columns of a result are turned into fields
+type ResultOptions struct {
+	// Return INTERVAL values as strings like the Timestream console, instead of numbers
+	IntervalsAsStrings bool `json:"intervalsAsStrings,omitempty"`
+
+	// Return each field of a ROW column as its own field, named column.field
+	FlattenRows bool `json:"flattenRows,omitempty"`
+
+	// Return the elements of ARRAY columns as rows or fields, instead of JSON
+	ExplodeArrays ArrayMode `json:"explodeArrays,omitempty"`
+}
+
+// Merge returns the options turned on in either, preferring the array mode of other
+// unless it is the default
+func (o ResultOptions) Merge(other ResultOptions) ResultOptions {
+	arrays := o.ExplodeArrays
+	if other.ExplodeArrays != ArrayModeDefault {
+		arrays = other.ExplodeArrays
+	}
+	return ResultOptions{
+		IntervalsAsStrings: o.IntervalsAsStrings || other.IntervalsAsStrings,
+		FlattenRows:        o.FlattenRows || other.FlattenRows,
+		ExplodeArrays:      arrays,
+	}
+}
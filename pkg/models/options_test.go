@@ -0,0 +1,23 @@
+package models
+
+import "testing"
+
+func TestResultOptionsMerge(t *testing.T) {
+	ds := ResultOptions{FlattenRows: true, ExplodeArrays: ArrayModeRows}
+
+	tests := []struct {
+		query ArrayMode
+		want  ArrayMode
+	}{
+		{ArrayModeDefault, ArrayModeRows},
+		{ArrayModeJSON, ArrayModeJSON},
+		{ArrayModeFields, ArrayModeFields},
+	}
+	for _, tt := range tests {
+		got := ds.Merge(ResultOptions{IntervalsAsStrings: true, ExplodeArrays: tt.query})
+		want := ResultOptions{IntervalsAsStrings: true, FlattenRows: true, ExplodeArrays: tt.want}
+		if got != want {
+			t.Fatalf("unexpected options for %q: %+v", tt.query, got)
+		}
+	}
+}
@@ -18,6 +18,10 @@ const (
 	FormatOptionTable FormatQueryOption = iota
 	//FormatOptionTimeSeries formats the query results as a timeseries using "WideToLong"
 	FormatOptionTimeSeries
+	// FormatOptionTimeSeriesWide merges TIMESERIES results into one frame with a shared time field
+	FormatOptionTimeSeriesWide
+	// FormatOptionTimeSeriesLong merges TIMESERIES results into one frame with a row for each point
+	FormatOptionTimeSeriesLong
 )
 
 var LegacyQueryCheck = regexp.MustCompile(`"format":\s*"table"`)
@@ -37,9 +41,31 @@ type QueryModel struct {
 	TimeRange     backend.TimeRange `json:"-"`
 	MaxDataPoints int64             `json:"-"`
 
+	// Set on the copy of the model being interpolated, by $__timeGroup with a fill mode
+	FillMissing *FillMissing `json:"-"`
+
 	// Return several pages (if exist) in one response
 	WaitForResult bool `json:"waitForResult"`
 
+	// Stop following pages once reached (combined with the datasource limits)
+	ResultLimits
+
+	// How result columns are turned into fields (combined with the datasource options)
+	ResultOptions
+
+	// Query this long before the dashboard time range, and move the results forward
+	// by the same amount so they overlay the current period
+	TimeShift Duration `json:"timeShift,omitempty"`
+
+	// Dashboard timezone, like Europe/Berlin
+	Timezone string `json:"timezone,omitempty"`
+
+	// Overrides the datasource query timeout
+	QueryTimeout Duration `json:"queryTimeout,omitempty"`
+
+	// Dashboard ad hoc filters, expanded by $__adhocFilters
+	AdhocFilters []AdhocFilter `json:"adhocFilters,omitempty"`
+
 	// Format the results
 	Format FormatQueryOption `json:"format"`
 }
@@ -75,6 +101,16 @@ func GetQueryModel(query backend.DataQuery) (*QueryModel, error) {
 	return model, nil
 }
 
+// AdhocFilter is one filter of a Grafana ad hoc filters variable
+type AdhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+
+	// Set by the one of / not one of operators
+	Values []string `json:"values,omitempty"`
+}
+
 // CancelRequest will cancel a running query
 type CancelRequest struct {
 	QueryID string `json:"queryId,omitempty"`
@@ -90,3 +126,14 @@ type MeasuresRequest struct {
 	Database string `json:"database"`
 	Table    string `json:"table"`
 }
+
+// TagValuesRequest will return the values of a dimension, for ad hoc filters
+type TagValuesRequest struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Key      string `json:"key"`
+
+	// Optional time range, in epoch milliseconds
+	From int64 `json:"from,omitempty"`
+	To   int64 `json:"to,omitempty"`
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/grafana/grafana-aws-sdk/pkg/awsds"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -18,17 +20,57 @@ type DatasourceSettings struct {
 	DefaultDatabase string `json:"defaultDatabase,omitempty"`
 	DefaultTable    string `json:"defaultTable,omitempty"`
 	DefaultMeasure  string `json:"defaultMeasure,omitempty"`
+
+	// Maximum number of queries from a single request executed at once
+	MaxConcurrentQueries int `json:"maxConcurrentQueries,omitempty"`
+
+	// Limits applied to every query that waits for all pages
+	ResultLimits
+
+	// How result columns are turned into fields
+	ResultOptions
+
+	// Retries of throttled or failed Timestream requests (zero disables retries)
+	MaxRetries int `json:"maxRetries"`
+
+	// Deadline for a query, including every page read for the response (none when zero)
+	QueryTimeout Duration `json:"queryTimeout,omitempty"`
+
+	// SQL fragments expanded as $__name(arg1, arg2), with $1, $2... replaced by the arguments
+	Macros map[string]string `json:"macros,omitempty"`
+
+	// Lower bound for the panel interval, like the write frequency of the tables
+	MinInterval Duration `json:"minInterval,omitempty"`
+
+	// Intervals the panel interval is rounded up to
+	IntervalRounding []Duration `json:"intervalRounding,omitempty"`
+
+	// Keep query results for this long (disabled when zero)
+	CacheTTL        Duration `json:"cacheTTL,omitempty"`
+	CacheMaxEntries int      `json:"cacheMaxEntries,omitempty"`
 }
 
+const (
+	// DefaultMaxConcurrentQueries is used when MaxConcurrentQueries is not configured
+	DefaultMaxConcurrentQueries = 5
+	// DefaultCacheMaxEntries is used when CacheMaxEntries is not configured
+	DefaultCacheMaxEntries = 100
+	// DefaultMaxRetries is used when MaxRetries is not configured
+	DefaultMaxRetries = 3
+)
+
 // Load is copied from grafana-aws-sdk -- json.Unmarshal was not loading the nested properties
 func (s *DatasourceSettings) Load(config backend.DataSourceInstanceSettings) error {
 	s.Config = config
+	s.MaxRetries = DefaultMaxRetries
 	if len(config.JSONData) > 1 {
 		if err := json.Unmarshal(config.JSONData, s); err != nil {
 			return fmt.Errorf("could not unmarshal DatasourceSettings json: %w", err)
 		}
 	}
 
+	slices.Sort(s.IntervalRounding)
+
 	if s.Region == "default" || s.Region == "" {
 		s.Region = s.DefaultRegion
 	}
@@ -43,3 +85,19 @@ func (s *DatasourceSettings) Load(config backend.DataSourceInstanceSettings) err
 
 	return nil
 }
+
+// AdjustInterval applies the minimum interval and the rounding table to a panel interval.
+// Intervals are at least a millisecond, the precision of $__interval. A missing (zero or
+// negative) interval becomes the minimum interval when one is set.
+func (s *DatasourceSettings) AdjustInterval(interval time.Duration) time.Duration {
+	if interval <= 0 && s.MinInterval <= 0 {
+		return interval
+	}
+	interval = max(interval, time.Duration(s.MinInterval), time.Millisecond)
+	for _, step := range s.IntervalRounding {
+		if time.Duration(step) >= interval {
+			return time.Duration(step)
+		}
+	}
+	return interval
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
@@ -15,7 +16,9 @@ func TestReadSettings(t *testing.T) {
 			"defaultDatabase": "sampleDB",
 			"defaultMeasure": "speed",
 			"defaultRegion": "us-west-2",
-			"defaultTable": "IoT"
+			"defaultTable": "IoT",
+			"cacheTTL": "90s",
+			"queryTimeout": "2m"
 		  }`),
 	}
 
@@ -28,4 +31,100 @@ func TestReadSettings(t *testing.T) {
 	if settings.DefaultDatabase != "sampleDB" {
 		t.Fatalf("invalid data points: %s", settings.DefaultDatabase)
 	}
+
+	if settings.MaxRetries != DefaultMaxRetries {
+		t.Fatalf("invalid max retries: %d", settings.MaxRetries)
+	}
+
+	if time.Duration(settings.CacheTTL) != 90*time.Second {
+		t.Fatalf("invalid cache ttl: %s", time.Duration(settings.CacheTTL))
+	}
+
+	if time.Duration(settings.QueryTimeout) != 2*time.Minute {
+		t.Fatalf("invalid query timeout: %s", time.Duration(settings.QueryTimeout))
+	}
+}
+
+func TestReadSettings_InvalidDuration(t *testing.T) {
+	settings := DatasourceSettings{}
+	err := settings.Load(backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"cacheTTL": "soon"}`),
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestReadSettings_DisableRetries(t *testing.T) {
+	settings := DatasourceSettings{}
+	err := settings.Load(backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"maxRetries": 0}`),
+	})
+	if err != nil {
+		t.Fatal("should not error")
+	}
+	if settings.MaxRetries != 0 {
+		t.Fatalf("invalid max retries: %d", settings.MaxRetries)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30s": 30 * time.Second,
+		"1h":  time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"-1d": -24 * time.Hour,
+	}
+	for s, expect := range tests {
+		d, err := ParseDuration(s)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", s, err)
+		}
+		if d != expect {
+			t.Fatalf("invalid duration for %s: %s", s, d)
+		}
+	}
+	if _, err := ParseDuration("1.5d"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestAdjustInterval(t *testing.T) {
+	settings := DatasourceSettings{}
+	err := settings.Load(backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"minInterval": "1m", "intervalRounding": ["1h", "5m", "15m"]}`),
+	})
+	if err != nil {
+		t.Fatal("should not error")
+	}
+
+	tests := map[time.Duration]time.Duration{
+		-time.Second:     5 * time.Minute,
+		0:                5 * time.Minute,
+		time.Millisecond: 5 * time.Minute,
+		time.Minute:      5 * time.Minute,
+		5 * time.Minute:  5 * time.Minute,
+		6 * time.Minute:  15 * time.Minute,
+		2 * time.Hour:    2 * time.Hour,
+	}
+	for interval, expect := range tests {
+		if got := settings.AdjustInterval(interval); got != expect {
+			t.Fatalf("invalid interval for %s: %s", interval, got)
+		}
+	}
+
+	settings = DatasourceSettings{MinInterval: Duration(time.Minute)}
+	if got := settings.AdjustInterval(10 * time.Second); got != time.Minute {
+		t.Fatalf("invalid interval: %s", got)
+	}
+	if got := settings.AdjustInterval(0); got != time.Minute {
+		t.Fatalf("invalid interval: %s", got)
+	}
+	if got := (&DatasourceSettings{}).AdjustInterval(0); got != 0 {
+		t.Fatalf("invalid interval: %s", got)
+	}
+	if got := (&DatasourceSettings{}).AdjustInterval(time.Microsecond); got != time.Millisecond {
+		t.Fatalf("invalid interval: %s", got)
+	}
 }
@@ -0,0 +1,129 @@
+package timestream
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// Upper bound on the fields an array column is split into
+const maxArrayFields = 100
+
+// explodeArrays returns a copy of the result with its ARRAY columns replaced by
+// their elements, as rows or as indexed fields. Results with time series are
+// returned as is. The result itself is not changed, as it may be cached.
+func explodeArrays(res *timestreamquery.QueryOutput, mode models.ArrayMode) (*timestreamquery.QueryOutput, error) {
+	arrays := []int{}
+	for i, column := range res.ColumnInfo {
+		if column.Type.TimeSeriesMeasureValueColumnInfo != nil {
+			return res, nil
+		}
+		if column.Type.ArrayColumnInfo != nil {
+			arrays = append(arrays, i)
+		}
+	}
+	if len(arrays) == 0 {
+		return res, nil
+	}
+
+	switch mode {
+	case models.ArrayModeRows:
+		return explodeArrayRows(res, arrays), nil
+	case models.ArrayModeFields:
+		return explodeArrayFields(res, arrays)
+	}
+	return nil, fmt.Errorf("unsupported array mode: %q, expecting rows or fields", mode)
+}
+
+// explodeArrayRows writes a row for each element, like UNNEST. Arrays of one row
+// are zipped, with nulls after the end of the shorter ones, and a row with no
+// elements is kept with nulls.
+func explodeArrayRows(res *timestreamquery.QueryOutput, arrays []int) *timestreamquery.QueryOutput {
+	out := *res
+	out.ColumnInfo = make([]timestreamquerytypes.ColumnInfo, len(res.ColumnInfo))
+	copy(out.ColumnInfo, res.ColumnInfo)
+	for _, idx := range arrays {
+		out.ColumnInfo[idx].Type = res.ColumnInfo[idx].Type.ArrayColumnInfo.Type
+	}
+
+	out.Rows = make([]timestreamquerytypes.Row, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		length := 1
+		for _, idx := range arrays {
+			if idx < len(row.Data) {
+				length = max(length, len(row.Data[idx].ArrayValue))
+			}
+		}
+		for i := 0; i < length; i++ {
+			data := make([]timestreamquerytypes.Datum, len(row.Data))
+			copy(data, row.Data)
+			for _, idx := range arrays {
+				if idx < len(data) {
+					data[idx] = arrayElement(row.Data[idx], i)
+				}
+			}
+			out.Rows = append(out.Rows, timestreamquerytypes.Row{Data: data})
+		}
+	}
+	return &out
+}
+
+// explodeArrayFields writes a field for each index, named column[0], column[1]...
+// Arrays shorter than the longest one are padded with nulls.
+func explodeArrayFields(res *timestreamquery.QueryOutput, arrays []int) (*timestreamquery.QueryOutput, error) {
+	lengths := make(map[int]int, len(arrays))
+	for _, idx := range arrays {
+		for _, row := range res.Rows {
+			if idx < len(row.Data) {
+				lengths[idx] = max(lengths[idx], len(row.Data[idx].ArrayValue))
+			}
+		}
+		if lengths[idx] > maxArrayFields {
+			return nil, fmt.Errorf("%s has more than %d elements, return its elements as rows instead", aws.ToString(res.ColumnInfo[idx].Name), maxArrayFields)
+		}
+	}
+
+	out := *res
+	out.ColumnInfo = []timestreamquerytypes.ColumnInfo{}
+	for i, column := range res.ColumnInfo {
+		length, isArray := lengths[i]
+		if !isArray {
+			out.ColumnInfo = append(out.ColumnInfo, column)
+			continue
+		}
+		for j := 0; j < length; j++ {
+			out.ColumnInfo = append(out.ColumnInfo, timestreamquerytypes.ColumnInfo{
+				Name: aws.String(fmt.Sprintf("%s[%d]", aws.ToString(column.Name), j)),
+				Type: column.Type.ArrayColumnInfo.Type,
+			})
+		}
+	}
+
+	out.Rows = make([]timestreamquerytypes.Row, len(res.Rows))
+	for r, row := range res.Rows {
+		data := make([]timestreamquerytypes.Datum, 0, len(out.ColumnInfo))
+		for i, datum := range row.Data {
+			length, isArray := lengths[i]
+			if !isArray {
+				data = append(data, datum)
+				continue
+			}
+			for j := 0; j < length; j++ {
+				data = append(data, arrayElement(datum, j))
+			}
+		}
+		out.Rows[r] = timestreamquerytypes.Row{Data: data}
+	}
+	return &out, nil
+}
+
+// arrayElement returns the element at idx, or null when the array is shorter or null
+func arrayElement(array timestreamquerytypes.Datum, idx int) timestreamquerytypes.Datum {
+	if idx < len(array.ArrayValue) {
+		return array.ArrayValue[idx]
+	}
+	return timestreamquerytypes.Datum{NullValue: aws.Bool(true)}
+}
@@ -0,0 +1,103 @@
+package timestream
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func arrayOf(values ...string) timestreamquerytypes.Datum {
+	array := []timestreamquerytypes.Datum{}
+	for _, v := range values {
+		array = append(array, timestreamquerytypes.Datum{ScalarValue: aws.String(v)})
+	}
+	return timestreamquerytypes.Datum{ArrayValue: array}
+}
+
+func arraysOutput() *timestreamquery.QueryOutput {
+	arrayType := func(t timestreamquerytypes.ScalarType) *timestreamquerytypes.Type {
+		return &timestreamquerytypes.Type{ArrayColumnInfo: &timestreamquerytypes.ColumnInfo{
+			Type: &timestreamquerytypes.Type{ScalarType: t},
+		}}
+	}
+	return &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("host"), Type: &timestreamquerytypes.Type{ScalarType: "VARCHAR"}},
+			{Name: aws.String("cpu"), Type: arrayType("DOUBLE")},
+			{Name: aws.String("core"), Type: arrayType("BIGINT")},
+		},
+		Rows: []timestreamquerytypes.Row{
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("a")}, arrayOf("0.5", "0.7"), arrayOf("1")}},
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("b")}, arrayOf(), {NullValue: aws.Bool(true)}}},
+		},
+	}
+}
+
+func TestQueryResultToDataFrame_ExplodeArrays(t *testing.T) {
+	t.Run("rows", func(t *testing.T) {
+		input := arraysOutput()
+		res := QueryResultToDataFrame(input, models.FormatOptionTable, models.ResultOptions{ExplodeArrays: models.ArrayModeRows})
+		require.NoError(t, res.Error)
+		frame := res.Frames[0]
+		require.Equal(t, 3, frame.Rows())
+		assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[1].Type())
+		assert.Equal(t, []*string{aws.String("a"), aws.String("a"), aws.String("b")}, valuesOf[*string](frame.Fields[0]))
+		assert.Equal(t, []*float64{ptr(0.5), ptr(0.7), nil}, valuesOf[*float64](frame.Fields[1]))
+		assert.Equal(t, []*int64{ptr(int64(1)), nil, nil}, valuesOf[*int64](frame.Fields[2]))
+
+		// The cached result is left alone
+		assert.Len(t, input.Rows, 2)
+		assert.NotNil(t, input.ColumnInfo[1].Type.ArrayColumnInfo)
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		res := QueryResultToDataFrame(arraysOutput(), models.FormatOptionTable, models.ResultOptions{ExplodeArrays: models.ArrayModeFields})
+		require.NoError(t, res.Error)
+		frame := res.Frames[0]
+		require.Equal(t, 2, frame.Rows())
+		names := []string{}
+		for _, f := range frame.Fields {
+			names = append(names, f.Name)
+		}
+		assert.Equal(t, []string{"host", "cpu[0]", "cpu[1]", "core[0]"}, names)
+		assert.Equal(t, []*float64{ptr(0.5), nil}, valuesOf[*float64](frame.Fields[1]))
+		assert.Equal(t, []*float64{ptr(0.7), nil}, valuesOf[*float64](frame.Fields[2]))
+	})
+
+	t.Run("rows of rows", func(t *testing.T) {
+		input := &timestreamquery.QueryOutput{
+			ColumnInfo: []timestreamquerytypes.ColumnInfo{
+				{Name: aws.String("stats"), Type: &timestreamquerytypes.Type{ArrayColumnInfo: &timestreamquerytypes.ColumnInfo{
+					Type: &timestreamquerytypes.Type{RowColumnInfo: []timestreamquerytypes.ColumnInfo{
+						{Name: aws.String("avg"), Type: &timestreamquerytypes.Type{ScalarType: "DOUBLE"}},
+					}},
+				}}},
+			},
+			Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{{ArrayValue: []timestreamquerytypes.Datum{
+				{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("1")}}}},
+				{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("2")}}}},
+			}}}}},
+		}
+		res := QueryResultToDataFrame(input, models.FormatOptionTable, models.ResultOptions{ExplodeArrays: models.ArrayModeRows, FlattenRows: true})
+		require.NoError(t, res.Error)
+		frame := res.Frames[0]
+		require.Len(t, frame.Fields, 1)
+		assert.Equal(t, "stats.avg", frame.Fields[0].Name)
+		assert.Equal(t, []*float64{ptr(1.0), ptr(2.0)}, valuesOf[*float64](frame.Fields[0]))
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		res := QueryResultToDataFrame(arraysOutput(), models.FormatOptionTable, models.ResultOptions{ExplodeArrays: "columns"})
+		require.NoError(t, res.Error)
+		frame := res.Frames[0]
+		assert.Equal(t, data.FieldTypeString, frame.Fields[1].Type())
+		require.Len(t, frame.Meta.Notices, 1)
+		assert.Contains(t, frame.Meta.Notices[0].Text, "unsupported array mode")
+	})
+}
@@ -0,0 +1,98 @@
+package timestream
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// queryCache keeps recent Timestream results so repeated refreshes of the
+// same query do not scan the table again. A nil cache is valid and never hits.
+type queryCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently used
+	now        func() time.Time
+}
+
+type cacheEntry struct {
+	key     string
+	result  *queryResult
+	expires time.Time
+}
+
+func newQueryCache(ttl time.Duration, maxEntries int) *queryCache {
+	if ttl <= 0 {
+		return nil
+	}
+	if maxEntries <= 0 {
+		maxEntries = models.DefaultCacheMaxEntries
+	}
+	return &queryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// cacheKey identifies a result by the interpolated SQL and the options that change its shape
+func cacheKey(raw string, query models.QueryModel) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%t\x00%s\x00%+v\x00%s", query.Format, query.WaitForResult, query.NextToken, query.ResultLimits, raw)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the cached result. Callers must not modify it.
+func (c *queryCache) get(key string) (*queryResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return entry.result, true
+}
+
+func (c *queryCache) set(key string, result *queryResult) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.result = result
+		entry.expires = expires
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, result: result, expires: expires})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,119 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCache(t *testing.T) {
+	t.Run("disabled without a ttl", func(t *testing.T) {
+		c := newQueryCache(0, 10)
+		assert.Nil(t, c)
+		c.set("a", &queryResult{})
+		_, ok := c.get("a")
+		assert.False(t, ok)
+	})
+
+	t.Run("entries expire", func(t *testing.T) {
+		now := time.Unix(0, 0)
+		c := newQueryCache(time.Minute, 10)
+		c.now = func() time.Time { return now }
+
+		out := &queryResult{pages: 2}
+		c.set("a", out)
+		got, ok := c.get("a")
+		require.True(t, ok)
+		assert.Same(t, out, got)
+
+		now = now.Add(2 * time.Minute)
+		_, ok = c.get("a")
+		assert.False(t, ok)
+	})
+
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		c := newQueryCache(time.Minute, 2)
+		c.set("a", &queryResult{})
+		c.set("b", &queryResult{})
+		_, ok := c.get("a")
+		require.True(t, ok)
+		c.set("c", &queryResult{})
+
+		_, ok = c.get("b")
+		assert.False(t, ok)
+		_, ok = c.get("a")
+		assert.True(t, ok)
+		_, ok = c.get("c")
+		assert.True(t, ok)
+	})
+
+	t.Run("key depends on format and pagination", func(t *testing.T) {
+		q := models.QueryModel{}
+		base := cacheKey("SELECT 1", q)
+		assert.Equal(t, base, cacheKey("SELECT 1", q))
+		assert.NotEqual(t, base, cacheKey("SELECT 2", q))
+		assert.NotEqual(t, base, cacheKey("SELECT 1", models.QueryModel{Format: models.FormatOptionTimeSeries}))
+		assert.NotEqual(t, base, cacheKey("SELECT 1", models.QueryModel{NextToken: "next"}))
+		assert.NotEqual(t, base, cacheKey("SELECT 1", models.QueryModel{WaitForResult: true}))
+	})
+}
+
+func TestExecuteQuery_Cache(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		QueryId:     aws.String("q"),
+		QueryStatus: &timestreamquerytypes.QueryStatus{CumulativeBytesScanned: 1000, CumulativeBytesMetered: 10000000},
+	}}
+	ds := &timestreamDS{Client: client, cache: newQueryCache(time.Minute, 10)}
+	query := models.QueryModel{RawQuery: "SELECT 1"}
+
+	first := ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, first.Error)
+	firstMeta := first.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.False(t, firstMeta.CacheHit)
+	assert.Equal(t, int64(1000), firstMeta.Stats.BytesScanned)
+	assert.Equal(t, 1, firstMeta.Stats.Pages)
+
+	second := ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, second.Error)
+	secondMeta := second.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.True(t, secondMeta.CacheHit)
+	assert.Equal(t, "q", secondMeta.QueryID)
+	assert.NotSame(t, first.Frames[0], second.Frames[0])
+
+	// Nothing was scanned, metered or paged for the cached response
+	assert.Zero(t, secondMeta.Stats.BytesScanned)
+	assert.Zero(t, secondMeta.Stats.BytesMetered)
+	assert.Zero(t, secondMeta.Stats.Pages)
+	for _, stat := range second.Frames[0].Meta.Stats {
+		if stat.DisplayName != "Execution time (Grafana server ⇆ Timestream)" {
+			assert.Zero(t, stat.Value, stat.DisplayName)
+		}
+	}
+
+	assert.Len(t, client.calls.runQuery, 1)
+}
+
+func TestExecuteQuery_CacheSkipsPagesWithNextToken(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		QueryId:   aws.String("q"),
+		NextToken: aws.String("next"),
+	}}
+	ds := &timestreamDS{Client: client, cache: newQueryCache(time.Minute, 10)}
+	query := models.QueryModel{RawQuery: "SELECT 1"}
+
+	for range 2 {
+		dr := ds.ExecuteQuery(context.Background(), query)
+		require.NoError(t, dr.Error)
+		assert.False(t, dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).CacheHit)
+	}
+	assert.Len(t, client.calls.runQuery, 2)
+	_, ok := ds.cache.get(cacheKey("SELECT 1", query))
+	assert.False(t, ok)
+}
@@ -3,7 +3,9 @@ package timestream
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/grafana/grafana-aws-sdk/pkg/awsauth"
@@ -12,6 +14,7 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/resource"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/concurrent"
 	"github.com/grafana/timestream-datasource/pkg/models"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -30,6 +33,10 @@ func NewDatasource(ctx context.Context, s backend.DataSourceInstanceSettings) (i
 	if err != nil {
 		return nil, backend.PluginError(fmt.Errorf("error reading settings: %s", err.Error()))
 	}
+	macros, err := newMacroSet(settings.Macros)
+	if err != nil {
+		return nil, backend.PluginError(fmt.Errorf("error reading macros: %s", err.Error()))
+	}
 
 	httpClientProvider := sdkhttpclient.NewProvider()
 	httpClientOptions, err := settings.Config.HTTPClientOptions(ctx)
@@ -90,17 +97,24 @@ func NewDatasource(ctx context.Context, s backend.DataSourceInstanceSettings) (i
 	return &timestreamDS{
 		Settings: settings,
 		Client:   client,
+		cache:    newQueryCache(time.Duration(settings.CacheTTL), settings.CacheMaxEntries),
+		macros:   macros,
 	}, nil
 }
 
 type timestreamDS struct {
 	Client   QueryClient
 	Settings models.DatasourceSettings
+
+	cache   *queryCache
+	macros  *macroSet
+	flights flightGroup
 }
 
 var (
 	_ backend.QueryDataHandler   = (*timestreamDS)(nil)
 	_ backend.CheckHealthHandler = (*timestreamDS)(nil)
+	_ backend.StreamHandler      = (*timestreamDS)(nil)
 )
 
 // CheckHealth will check the currently configured settings
@@ -138,16 +152,24 @@ func (ds *timestreamDS) CheckHealth(ctx context.Context, req *backend.CheckHealt
 
 // QueryData - Primary method called by grafana-server
 func (ds *timestreamDS) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
-	res := backend.NewQueryDataResponse()
-	for _, q := range req.Queries {
-		query, err := models.GetQueryModel(q)
-		if err != nil {
-			res.Responses[q.RefID] = backend.ErrorResponseWithErrorSource(err)
-		} else {
-			res.Responses[q.RefID] = ds.ExecuteQuery(ctx, *query)
-		}
+	concurrency := ds.Settings.MaxConcurrentQueries
+	if concurrency <= 0 {
+		concurrency = models.DefaultMaxConcurrentQueries
 	}
-	return res, nil
+	return concurrent.QueryData(ctx, req, ds.handleQuery, concurrency)
+}
+
+// handleQuery runs a single query of a request, panics are turned into an error response by the caller
+func (ds *timestreamDS) handleQuery(ctx context.Context, q concurrent.Query) backend.DataResponse {
+	query, err := models.GetQueryModel(q.DataQuery)
+	if err != nil {
+		return backend.ErrorResponseWithErrorSource(err)
+	}
+	res := ds.ExecuteQuery(ctx, *query)
+	if !query.WaitForResult {
+		ds.attachStream(q.PluginContext, *query, &res)
+	}
+	return res
 }
 
 func sliceFromRows(rows []timestreamquerytypes.Row, doubleQuotes bool) []string {
@@ -179,8 +201,51 @@ func dimensionsFromRows(rows []timestreamquerytypes.Row) []string {
 	return res
 }
 
+// tagKeysFromRows returns the dimensions of every measure, and the measure name
+func tagKeysFromRows(rows []timestreamquerytypes.Row) []string {
+	res := []string{measureNameKey}
+	for _, row := range rows {
+		if len(row.Data) != 3 {
+			continue
+		}
+		for _, dim := range row.Data[2].ArrayValue {
+			if dim.RowValue == nil || len(dim.RowValue.Data) == 0 || dim.RowValue.Data[0].ScalarValue == nil {
+				continue
+			}
+			if name := *dim.RowValue.Data[0].ScalarValue; !slices.Contains(res, name) {
+				res = append(res, name)
+			}
+		}
+	}
+	return res
+}
+
+// datumsSize approximates the memory used by result values
+func datumsSize(datums []timestreamquerytypes.Datum) int64 {
+	size := int64(0)
+	for _, d := range datums {
+		if d.ScalarValue != nil {
+			size += int64(len(*d.ScalarValue))
+		}
+		if d.RowValue != nil {
+			size += datumsSize(d.RowValue.Data)
+		}
+		size += datumsSize(d.ArrayValue)
+		for _, p := range d.TimeSeriesValue {
+			if p.Time != nil {
+				size += int64(len(*p.Time))
+			}
+			if p.Value != nil {
+				size += datumsSize([]timestreamquerytypes.Datum{*p.Value})
+			}
+		}
+	}
+	return size
+}
+
 // CallResource HTTP style resource
 func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	ds.recordResourceCall(req.Path)
 	if req.Path == "hello" {
 		return resource.SendPlainText(sender, "world")
 	}
@@ -194,11 +259,9 @@ func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResou
 		if err != nil {
 			return fmt.Errorf("error reading cancel request: %s", err.Error())
 		}
-		cancelQueryInput := &timestreamquery.CancelQueryInput{
-			QueryId: aws.String(cancel.QueryID),
-		}
 		msg := "cancel: " + cancel.QueryID
-		v, err := ds.Client.CancelQuery(ctx, cancelQueryInput)
+		ds.recordCancellation(cancelReasonUser)
+		v, err := ds.cancelQuery(ctx, cancel.QueryID)
 		if v != nil && v.CancellationMessage != nil {
 			msg = *v.CancellationMessage
 		} else if err != nil {
@@ -208,14 +271,12 @@ func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResou
 	}
 	if req.Path == "databases" {
 		// TODO: Use API endpoint to list databases
-		v, err := ds.Client.Query(ctx, &timestreamquery.QueryInput{
-			QueryString: aws.String("SHOW DATABASES"),
-		})
+		res, err := ds.resourceQuery(ctx, "SHOW DATABASES")
 		if err != nil {
 			return err
 		}
 		// Databases are returned wrapped in double quotes
-		return resource.SendJSON(sender, sliceFromRows(v.Rows, true))
+		return resource.SendJSON(sender, sliceFromRows(res.output.Rows, true))
 	}
 	if req.Path == "tables" {
 		if req.Method != "POST" {
@@ -227,14 +288,12 @@ func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResou
 			return err
 		}
 		// TODO: Use API endpoint to list tables
-		v, err := ds.Client.Query(ctx, &timestreamquery.QueryInput{
-			QueryString: aws.String(fmt.Sprintf("SHOW TABLES FROM %s", applyQuotesIfNeeded(opts.Database))),
-		})
+		res, err := ds.resourceQuery(ctx, fmt.Sprintf("SHOW TABLES FROM %s", applyQuotesIfNeeded(opts.Database)))
 		if err != nil {
 			return err
 		}
 		// Tables are returned wrapped in double quotes
-		return resource.SendJSON(sender, sliceFromRows(v.Rows, true))
+		return resource.SendJSON(sender, sliceFromRows(res.output.Rows, true))
 	}
 	if req.Path == "measures" || req.Path == "dimensions" {
 		if req.Method != "POST" {
@@ -245,22 +304,108 @@ func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResou
 		if err != nil {
 			return err
 		}
-		v, err := ds.Client.Query(ctx, &timestreamquery.QueryInput{
-			QueryString: aws.String(fmt.Sprintf("SHOW MEASURES FROM %s.%s", applyQuotesIfNeeded(opts.Database), applyQuotesIfNeeded(opts.Table))),
-		})
+		res, err := ds.resourceQuery(ctx, fmt.Sprintf("SHOW MEASURES FROM %s.%s", applyQuotesIfNeeded(opts.Database), applyQuotesIfNeeded(opts.Table)))
 		if err != nil {
 			return err
 		}
 		if req.Path == "measures" {
-			return resource.SendJSON(sender, sliceFromRows(v.Rows, false))
+			return resource.SendJSON(sender, sliceFromRows(res.output.Rows, false))
 		}
 		if req.Path == "dimensions" {
-			return resource.SendJSON(sender, dimensionsFromRows(v.Rows))
+			return resource.SendJSON(sender, dimensionsFromRows(res.output.Rows))
 		}
 	}
+	if req.Path == "tag-keys" {
+		if req.Method != "POST" {
+			return fmt.Errorf("tag-keys requires a post command")
+		}
+		opts := models.MeasuresRequest{}
+		err := json.Unmarshal(req.Body, &opts)
+		if err != nil {
+			return err
+		}
+		res, err := ds.showMeasures(ctx, opts.Database, opts.Table)
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, tagKeysFromRows(res.output.Rows))
+	}
+	if req.Path == "tag-values" {
+		if req.Method != "POST" {
+			return fmt.Errorf("tag-values requires a post command")
+		}
+		opts := models.TagValuesRequest{}
+		err := json.Unmarshal(req.Body, &opts)
+		if err != nil {
+			return err
+		}
+		if opts.Key == "" {
+			return fmt.Errorf("tag-values requires a key")
+		}
+		if opts.Key == measureNameKey {
+			res, err := ds.showMeasures(ctx, opts.Database, opts.Table)
+			if err != nil {
+				return err
+			}
+			return resource.SendJSON(sender, sliceFromRows(res.output.Rows, false))
+		}
+		sql, err := ds.tagValuesQuery(opts)
+		if err != nil {
+			return err
+		}
+		res, err := ds.resourceQuery(ctx, sql)
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, sliceFromRows(res.output.Rows, false))
+	}
 	return fmt.Errorf("unknown resource")
 }
 
+// The column holding the measure of each record, offered as an ad hoc filter key
+const measureNameKey = "measure_name"
+
+// Upper bound on the values offered for an ad hoc filter key
+const maxTagValues = 1000
+
+// showMeasures lists the measures of a table, defaulting to the datasource table
+func (ds *timestreamDS) showMeasures(ctx context.Context, database, table string) (*queryResult, error) {
+	database = valueOrDefault(database, ds.Settings.DefaultDatabase)
+	table = valueOrDefault(table, ds.Settings.DefaultTable)
+	if database == "" || table == "" {
+		return nil, fmt.Errorf("a database and a table are required")
+	}
+	return ds.resourceQuery(ctx, fmt.Sprintf("SHOW MEASURES FROM %s.%s", applyQuotesIfNeeded(database), applyQuotesIfNeeded(table)))
+}
+
+// resourceQuery reads every page of a schema or ad hoc filter lookup. It is counted
+// in the query metrics like the queries of panels.
+func (ds *timestreamDS) resourceQuery(ctx context.Context, sql string) (*queryResult, error) {
+	start := time.Now()
+	res, err := ds.runQuery(ctx, &timestreamquery.QueryInput{
+		QueryString: aws.String(sql),
+	}, models.QueryModel{WaitForResult: true})
+	ds.recordQuery(res, time.Since(start).Seconds(), err)
+	return res, err
+}
+
+// tagValuesQuery lists the distinct values of a dimension in the time range,
+// or in the last hour when there is none
+func (ds *timestreamDS) tagValuesQuery(opts models.TagValuesRequest) (string, error) {
+	database := valueOrDefault(opts.Database, ds.Settings.DefaultDatabase)
+	table := valueOrDefault(opts.Table, ds.Settings.DefaultTable)
+	if database == "" || table == "" {
+		return "", fmt.Errorf("a database and a table are required")
+	}
+	timeFilter := "time > ago(1h)"
+	if opts.From > 0 && opts.To >= opts.From {
+		timeFilter = fmt.Sprintf("time BETWEEN from_milliseconds(%d) AND from_milliseconds(%d)", opts.From, opts.To)
+	}
+	key := quoteIdentifier(opts.Key)
+	return fmt.Sprintf("SELECT DISTINCT %s FROM %s.%s WHERE %s AND %s IS NOT NULL ORDER BY 1 LIMIT %d",
+		key, applyQuotesIfNeeded(database), applyQuotesIfNeeded(table), timeFilter, key, maxTagValues), nil
+}
+
 func applyQuotesIfNeeded(input string) string {
 	if input[0] != '"' && input[len(input)-1] != '"' {
 		input = fmt.Sprintf(`"%s"`, input)
@@ -268,12 +413,182 @@ func applyQuotesIfNeeded(input string) string {
 	return input
 }
 
+// How long to wait for Timestream to accept a cancellation
+const cancelTimeout = 10 * time.Second
+
+// cancelQuery stops a running Timestream query
+func (ds *timestreamDS) cancelQuery(ctx context.Context, queryID string) (*timestreamquery.CancelQueryOutput, error) {
+	return ds.Client.CancelQuery(ctx, &timestreamquery.CancelQueryInput{
+		QueryId: aws.String(queryID),
+	})
+}
+
+// cancelOnDone cancels the query in Timestream if ctx is done before stop is called,
+// so abandoned requests do not keep scanning (and billing) in the background
+func (ds *timestreamDS) cancelOnDone(ctx context.Context, queryID string) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		cancelCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelTimeout)
+		defer cancel()
+		reason := cancelReasonRequest
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			reason = cancelReasonTimeout
+		}
+		backend.Logger.Info("request cancelled, cancelling timestream query", "queryId", queryID, "reason", reason)
+		ds.recordCancellation(reason)
+		if _, err := ds.cancelQuery(cancelCtx, queryID); err != nil {
+			backend.Logger.Warn("failed to cancel timestream query", "queryId", queryID, "error", err.Error())
+		}
+	})
+}
+
+// queryTimeout returns the deadline for the query, preferring the query override
+func (ds *timestreamDS) queryTimeout(query models.QueryModel) time.Duration {
+	if query.QueryTimeout > 0 {
+		return time.Duration(query.QueryTimeout)
+	}
+	return time.Duration(ds.Settings.QueryTimeout)
+}
+
+// queryResult holds the merged output of every page read for one response
+type queryResult struct {
+	output  *timestreamquery.QueryOutput
+	pages   int
+	retries int
+
+	// Timestream reports cumulative figures, so these are the largest seen on any page
+	bytesScanned int64
+	bytesMetered int64
+
+	// Approximate size of the rows read
+	size int64
+
+	// The limit that stopped pagination early, if any
+	limit string
+}
+
+// addRows appends the rows of a page
+func (r *queryResult) addRows(rows []timestreamquerytypes.Row) {
+	for _, row := range rows {
+		r.size += datumsSize(row.Data)
+	}
+	r.output.Rows = append(r.output.Rows, rows...)
+}
+
+// Timestream returns at most this many rows per page
+const maxPageRows = 1000
+
+// pageInput requests a page with no more rows than the row limit leaves, so pages
+// never have to be cut and the NextToken continues right after the rows returned
+func pageInput(input *timestreamquery.QueryInput, limits models.ResultLimits, rows int) *timestreamquery.QueryInput {
+	page := *input
+	if limits.MaxRows > 0 {
+		page.MaxRows = aws.Int32(int32(min(limits.MaxRows-int64(rows), maxPageRows)))
+	}
+	return &page
+}
+
+func (r *queryResult) addStatus(status *timestreamquerytypes.QueryStatus) {
+	if status == nil {
+		return
+	}
+	r.bytesScanned = max(r.bytesScanned, status.CumulativeBytesScanned)
+	r.bytesMetered = max(r.bytesMetered, status.CumulativeBytesMetered)
+}
+
+// runQuery executes the query and, when WaitForResult is set, follows the NextToken.
+// The query is cancelled in Timestream if ctx is done while it still has pages.
+func (ds *timestreamDS) runQuery(ctx context.Context, input *timestreamquery.QueryInput, query models.QueryModel) (*queryResult, error) {
+	res := &queryResult{}
+	limits := models.ResultLimits{}
+	if query.WaitForResult {
+		limits = ds.Settings.ResultLimits.Stricter(query.ResultLimits)
+	}
+	output, retries, err := ds.queryWithRetry(ctx, pageInput(input, limits, 0))
+	res.retries = retries
+	if err != nil {
+		return res, err
+	}
+	res.output = output
+	res.pages = 1
+	res.addStatus(output.QueryStatus)
+	// Timestream only returns the QueryId with the first page, so a query cancelled
+	// before then can not be cancelled in Timestream and runs to completion there
+	if output.QueryId != nil && output.NextToken != nil {
+		stopCancel := ds.cancelOnDone(ctx, *output.QueryId)
+		defer stopCancel()
+	}
+	if !query.WaitForResult {
+		return res, nil
+	}
+
+	rows := output.Rows
+	output.Rows = nil
+	res.addRows(rows)
+	for output.NextToken != nil {
+		if res.limit = limits.Exceeded(int64(len(output.Rows)), int64(res.pages), res.size); res.limit != "" {
+			// Keep the NextToken so the remaining pages can be requested deliberately
+			break
+		}
+		newPageInput := pageInput(input, limits, len(output.Rows))
+		newPageInput.NextToken = output.NextToken
+		newPageOutput, newPageRetries, newPageErr := ds.queryWithRetry(ctx, newPageInput)
+		res.retries += newPageRetries
+		if newPageErr != nil {
+			output.NextToken = nil
+			return res, newPageErr
+		}
+		output.NextToken = newPageOutput.NextToken
+		output.QueryStatus = newPageOutput.QueryStatus
+		res.pages++
+		res.addStatus(newPageOutput.QueryStatus)
+		res.addRows(newPageOutput.Rows)
+	}
+	return res, nil
+}
+
+// fillFrames fills the missing $__timeGroup buckets of every frame in a complete response
+func fillFrames(dr *backend.DataResponse, fill models.FillMissing, timeRange backend.TimeRange) {
+	if meta, ok := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta); ok && meta.NextToken != "" {
+		dr.Frames[0].AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "Missing time buckets were not filled because the results have more pages. Turn on Wait for all queries to fill them.",
+		})
+		return
+	}
+	var fillErr error
+	for i, frame := range dr.Frames {
+		filled, err := fillMissing(frame, fill, timeRange)
+		if err != nil {
+			fillErr = err
+			continue
+		}
+		dr.Frames[i] = filled
+	}
+	if fillErr != nil {
+		dr.Frames[0].AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: fillErr.Error()})
+	}
+}
+
 // ExecuteQuery -- run a query
 func (ds *timestreamDS) ExecuteQuery(ctx context.Context, query models.QueryModel) backend.DataResponse {
-	raw, err := Interpolate(query, ds.Settings)
+	timeShift := time.Duration(query.TimeShift)
+	query.TimeRange = shiftTimeRange(query.TimeRange, timeShift)
+	raw, fill, err := ds.macros.interpolate(query, ds.Settings)
 	if err != nil {
 		return backend.ErrorResponseWithErrorSource(backend.DownstreamError(err))
 	}
+	return ds.executeSQL(ctx, query, raw, fill)
+}
+
+// continueQuery reads the next page of a query. Its RawQuery is the executed SQL, which
+// is sent as is: expanding it again could change it, and the NextToken belongs to it.
+func (ds *timestreamDS) continueQuery(ctx context.Context, query models.QueryModel) backend.DataResponse {
+	return ds.executeSQL(ctx, query, query.RawQuery, nil)
+}
+
+// executeSQL runs the expanded SQL of a query, and fills missing buckets when requested
+func (ds *timestreamDS) executeSQL(ctx context.Context, query models.QueryModel, raw string, fill *models.FillMissing) backend.DataResponse {
+	timeShift := time.Duration(query.TimeShift)
 	input := &timestreamquery.QueryInput{
 		QueryString: aws.String(raw),
 	}
@@ -283,31 +598,58 @@ func (ds *timestreamDS) ExecuteQuery(ctx context.Context, query models.QueryMode
 		backend.Logger.Info("running continue query", "token", query.NextToken)
 	}
 
-	start := time.Now().UnixMilli()
-	output, err := ds.Client.Query(ctx, input)
-	if err == nil && query.WaitForResult && output.NextToken != nil {
-		for output.NextToken != nil {
-			newPageInput := *input
-			newPageInput.NextToken = output.NextToken
-			newPageOutput, newPageErr := ds.Client.Query(ctx, &newPageInput)
-			if newPageErr != nil {
-				err = newPageErr
-				output.NextToken = nil
-				continue
+	timeout := ds.queryTimeout(query)
+
+	start := time.Now()
+	key := cacheKey(raw, query)
+	res, cacheHit := ds.cache.get(key)
+	deduplicated := false
+	var err error
+	if cacheHit {
+		// Nothing was retried for this request
+		cached := *res
+		cached.retries = 0
+		res = &cached
+	} else {
+		// Queries with different timeouts do not share an execution, so none runs longer than it allows
+		flightKey := fmt.Sprintf("%s\x00%d\x00%d\x00%d", key, query.TimeRange.From.UnixNano(), query.TimeRange.To.UnixNano(), timeout)
+		res, deduplicated, err = ds.flights.do(ctx, flightKey, func(ctx context.Context) (*queryResult, error) {
+			// The deadline applies to the shared execution, so it cancels the query in Timestream
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			res, err := ds.runQuery(ctx, input, query)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("query timed out after %s: %w", timeout, context.DeadlineExceeded)
+			}
+			ds.recordQuery(res, time.Since(start).Seconds(), err)
+			// A NextToken may only be used a few times and for a limited time, so
+			// results with more pages are not cached
+			if err == nil && res.output.NextToken == nil {
+				ds.cache.set(key, res)
 			}
-			output.Rows = append(output.Rows, newPageOutput.Rows...)
-			output.NextToken = newPageOutput.NextToken
+			return res, err
+		})
+		if res == nil {
+			// The request was cancelled while waiting
+			res = &queryResult{}
 		}
 	}
 
 	dr := backend.DataResponse{}
 	if err == nil {
-		dr = QueryResultToDataFrame(output, query.Format)
+		dr = QueryResultToDataFrame(res.output, query.Format, ds.Settings.ResultOptions.Merge(query.ResultOptions))
+		if fill != nil && dr.Error == nil {
+			fillFrames(&dr, *fill, query.TimeRange)
+		}
+		shiftFrames(dr.Frames, timeShift)
 	} else {
 		// override: false here because runQuery may return a PluginError
 		dr = backend.ErrorResponseWithErrorSource(backend.DownstreamError(err))
 	}
-	finish := time.Now().UnixMilli()
+	finish := time.Now()
 
 	// Needs a frame for the metadata... even if just error
 	if len(dr.Frames) == 0 {
@@ -318,22 +660,46 @@ func (ds *timestreamDS) ExecuteQuery(ctx context.Context, query models.QueryMode
 		frame.SetMeta(&data.FrameMeta{})
 	}
 	frame.Meta.ExecutedQueryString = raw
+	if res.limit != "" {
+		text := fmt.Sprintf("Partial results: the %s limit was reached after %d pages and %d rows.", res.limit, res.pages, len(res.output.Rows))
+		if res.output.NextToken != nil {
+			text += " Use the next token in the query metadata to continue."
+		}
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: text})
+	}
 
 	if frame.Meta.Custom == nil {
 		frame.Meta.Custom = &models.TimestreamCustomMeta{}
 	}
-	if output != nil && output.QueryStatus != nil {
+	if res.output != nil && res.output.QueryStatus != nil {
 		c := frame.Meta.Custom.(*models.TimestreamCustomMeta)
-		c.Status = output.QueryStatus
+		c.Status = res.output.QueryStatus
 	}
 
 	// Apply the timing info
 	meta := frame.Meta.Custom.(*models.TimestreamCustomMeta)
+	meta.CacheHit = cacheHit
+	meta.Deduplicated = deduplicated
+	meta.Retries = res.retries
 	if meta.NextToken == "" {
-		meta.FinishTime = finish
+		meta.FinishTime = finish.UnixMilli()
 	}
 	if input.NextToken == nil {
-		meta.StartTime = start
+		meta.StartTime = start.UnixMilli()
+	}
+
+	if res.output != nil {
+		meta.Stats = &models.QueryStats{
+			Rows:       len(res.output.Rows),
+			DurationMs: finish.Sub(start).Milliseconds(),
+		}
+		if !cacheHit {
+			// A cached result costs nothing and reads no pages
+			meta.Stats.BytesScanned = res.bytesScanned
+			meta.Stats.BytesMetered = res.bytesMetered
+			meta.Stats.Pages = res.pages
+		}
+		frame.Meta.Stats = append(frame.Meta.Stats, meta.Stats.QueryStats()...)
 	}
 	return dr
 }
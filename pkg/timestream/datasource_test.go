@@ -8,7 +8,9 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/experimental"
 	"github.com/grafana/timestream-datasource/pkg/models"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
@@ -120,6 +122,46 @@ func TestCallResource(t *testing.T) {
 			},
 			`["foo","bar"]`,
 		},
+		{
+			"tag keys request",
+			&timestreamquery.QueryOutput{
+				Rows: []timestreamquerytypes.Row{
+					{Data: []timestreamquerytypes.Datum{
+						{}, {},
+						{ArrayValue: []timestreamquerytypes.Datum{
+							{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("region")}}}},
+						}},
+					}},
+					{Data: []timestreamquerytypes.Datum{
+						{}, {},
+						{ArrayValue: []timestreamquerytypes.Datum{
+							{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("region")}}}},
+							{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("az")}}}},
+						}},
+					}},
+				},
+			},
+			&backend.CallResourceRequest{
+				Method: "POST",
+				Path:   "tag-keys",
+				Body:   []byte(`{"database":"db","table":"t"}`),
+			},
+			`["measure_name","region","az"]`,
+		},
+		{
+			"tag values request",
+			&timestreamquery.QueryOutput{
+				Rows: []timestreamquerytypes.Row{
+					{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("us-east-1")}}},
+				},
+			},
+			&backend.CallResourceRequest{
+				Method: "POST",
+				Path:   "tag-values",
+				Body:   []byte(`{"database":"db","table":"t","key":"region"}`),
+			},
+			`["us-east-1"]`,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
@@ -138,7 +180,7 @@ func TestCallResource(t *testing.T) {
 
 func Test_runQuery_always_wraps_db_and_table_name_in_quotes(t *testing.T) {
 	testCases := []struct {
-		name, resource, requestBody, expectedQuery string
+		name, resource, requestBody, expectedQuery, expectedErr string
 	}{
 		{
 			resource:      "tables",
@@ -170,6 +212,36 @@ func Test_runQuery_always_wraps_db_and_table_name_in_quotes(t *testing.T) {
 			requestBody:   `{"database":"\"db\"","table":"\"some_table_name\""}`,
 			expectedQuery: `SHOW MEASURES FROM "db"."some_table_name"`,
 		},
+		{
+			resource:      "tag-keys",
+			requestBody:   `{"database":"db","table":"some_table_name"}`,
+			expectedQuery: `SHOW MEASURES FROM "db"."some_table_name"`,
+		},
+		{
+			resource:      "tag-values",
+			requestBody:   `{"database":"db","table":"some_table_name","key":"measure_name"}`,
+			expectedQuery: `SHOW MEASURES FROM "db"."some_table_name"`,
+		},
+		{
+			resource:      "tag-values",
+			requestBody:   `{"database":"db","table":"some_table_name","key":"cell\"name"}`,
+			expectedQuery: `SELECT DISTINCT "cell""name" FROM "db"."some_table_name" WHERE time > ago(1h) AND "cell""name" IS NOT NULL ORDER BY 1 LIMIT 1000`,
+		},
+		{
+			resource:      "tag-values",
+			requestBody:   `{"database":"db","table":"some_table_name","key":"az","from":1000,"to":2000}`,
+			expectedQuery: `SELECT DISTINCT "az" FROM "db"."some_table_name" WHERE time BETWEEN from_milliseconds(1000) AND from_milliseconds(2000) AND "az" IS NOT NULL ORDER BY 1 LIMIT 1000`,
+		},
+		{
+			resource:    "tag-values",
+			requestBody: `{"key":"az"}`,
+			expectedErr: "a database and a table are required",
+		},
+		{
+			resource:    "tag-keys",
+			requestBody: `{}`,
+			expectedErr: "a database and a table are required",
+		},
 	}
 
 	for _, test := range testCases {
@@ -177,12 +249,18 @@ func Test_runQuery_always_wraps_db_and_table_name_in_quotes(t *testing.T) {
 			client := &fakeClient{output: &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{}}}
 			ds := &timestreamDS{Client: client}
 
-			assert.NoError(t, ds.CallResource(context.Background(),
+			err := ds.CallResource(context.Background(),
 				&backend.CallResourceRequest{
 					Method: "POST",
 					Path:   test.resource,
 					Body:   []byte(test.requestBody),
-				}, &fakeSender{}))
+				}, &fakeSender{})
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				assert.Empty(t, client.calls.runQuery)
+				return
+			}
+			assert.NoError(t, err)
 
 			require.Len(t, client.calls.runQuery, 1)
 			assert.Equal(t, &timestreamquery.QueryInput{QueryString: &test.expectedQuery}, client.calls.runQuery[0])
@@ -190,6 +268,441 @@ func Test_runQuery_always_wraps_db_and_table_name_in_quotes(t *testing.T) {
 	}
 }
 
+type concurrentClient struct {
+	mu       sync.Mutex
+	inFlight int
+	maxSeen  int
+	release  chan struct{}
+}
+
+func (c *concurrentClient) Query(_ context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxSeen {
+		c.maxSeen = c.inFlight
+	}
+	c.mu.Unlock()
+
+	<-c.release
+
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+
+	if *input.QueryString == "fail" {
+		return nil, fmt.Errorf("boom")
+	}
+	return &timestreamquery.QueryOutput{}, nil
+}
+
+func (c *concurrentClient) running() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight
+}
+
+func (c *concurrentClient) CancelQuery(context.Context, *timestreamquery.CancelQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	return nil, nil
+}
+
+func TestQueryData_Concurrent(t *testing.T) {
+	client := &concurrentClient{release: make(chan struct{})}
+	ds := &timestreamDS{
+		Client:   client,
+		Settings: models.DatasourceSettings{MaxConcurrentQueries: 2},
+	}
+
+	req := &backend.QueryDataRequest{}
+	for _, refID := range []string{"A", "B", "C", "D"} {
+		// Distinct SQL so the queries are not shared
+		raw := fmt.Sprintf("SELECT '%s'", refID)
+		if refID == "C" {
+			raw = "fail"
+		}
+		req.Queries = append(req.Queries, backend.DataQuery{
+			RefID: refID,
+			JSON:  []byte(fmt.Sprintf(`{"rawQuery":%q}`, raw)),
+		})
+	}
+	req.Queries = append(req.Queries, backend.DataQuery{RefID: "E", JSON: []byte(`{`)})
+
+	go func() {
+		// Hold the first queries until both slots are taken
+		for client.running() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		for range 4 {
+			client.release <- struct{}{}
+		}
+	}()
+
+	res, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, res.Responses, 5)
+
+	assert.NoError(t, res.Responses["A"].Error)
+	assert.NoError(t, res.Responses["B"].Error)
+	assert.NoError(t, res.Responses["D"].Error)
+	assert.ErrorContains(t, res.Responses["C"].Error, "boom")
+	assert.ErrorContains(t, res.Responses["E"].Error, "error reading query")
+	assert.Equal(t, 2, client.maxSeen)
+}
+
+// pagedClient returns the pages in order
+type pagedClient struct {
+	pages  []*timestreamquery.QueryOutput
+	index  int
+	inputs []*timestreamquery.QueryInput
+}
+
+// Query returns the next page, with no more rows than requested like Timestream
+func (c *pagedClient) Query(_ context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	c.inputs = append(c.inputs, input)
+	page := c.pages[c.index]
+	c.index++
+	if input.MaxRows != nil && len(page.Rows) > int(*input.MaxRows) {
+		trimmed := *page
+		trimmed.Rows = page.Rows[:*input.MaxRows]
+		page = &trimmed
+	}
+	return page, nil
+}
+
+func (c *pagedClient) CancelQuery(context.Context, *timestreamquery.CancelQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	return nil, nil
+}
+
+func TestExecuteQuery_ResultLimits(t *testing.T) {
+	t.Run("stops at the datasource limit", func(t *testing.T) {
+		client := &MockClient{testFileNames: []string{"pagination-off_1", "pagination-off_2"}}
+		ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{
+			ResultLimits: models.ResultLimits{MaxPages: 1},
+		}}
+		dr := ds.ExecuteQuery(context.Background(), models.QueryModel{WaitForResult: true})
+		require.NoError(t, dr.Error)
+
+		assert.Equal(t, 1, client.index)
+		meta := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+		assert.NotEmpty(t, meta.NextToken)
+		require.Len(t, dr.Frames[0].Meta.Notices, 1)
+		assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "max pages")
+	})
+
+	t.Run("query limits are combined with the datasource limits", func(t *testing.T) {
+		page := func(next *string) *timestreamquery.QueryOutput {
+			return &timestreamquery.QueryOutput{
+				ColumnInfo: []timestreamquerytypes.ColumnInfo{
+					{Name: aws.String("v"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+				},
+				Rows: []timestreamquerytypes.Row{
+					{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("a")}}},
+					{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("b")}}},
+				},
+				NextToken: next,
+			}
+		}
+		client := &pagedClient{pages: []*timestreamquery.QueryOutput{
+			page(aws.String("1")), page(aws.String("2")), page(nil),
+		}}
+		ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{
+			ResultLimits: models.ResultLimits{MaxPages: 10},
+		}}
+		dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+			WaitForResult: true,
+			ResultLimits:  models.ResultLimits{MaxRows: 3},
+		})
+		require.NoError(t, dr.Error)
+		assert.Equal(t, 2, client.index)
+		assert.Equal(t, 3, dr.Frames[0].Rows())
+		assert.Equal(t, "2", dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).NextToken)
+		require.Len(t, dr.Frames[0].Meta.Notices, 1)
+		assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "max rows")
+
+		// The second page only asks for the row that is left
+		require.Len(t, client.inputs, 2)
+		assert.Equal(t, int32(3), *client.inputs[0].MaxRows)
+		assert.Equal(t, int32(1), *client.inputs[1].MaxRows)
+	})
+
+	t.Run("keeps whole pages at the row and byte limits", func(t *testing.T) {
+		page := &timestreamquery.QueryOutput{
+			ColumnInfo: []timestreamquerytypes.ColumnInfo{
+				{Name: aws.String("v"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+			},
+			NextToken: aws.String("more"),
+		}
+		for range 1000 {
+			page.Rows = append(page.Rows, timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("abcd")}}})
+		}
+		tests := []struct {
+			name   string
+			limits models.ResultLimits
+			rows   int
+			limit  string
+		}{
+			{"rows", models.ResultLimits{MaxRows: 10}, 10, "max rows"},
+			{"bytes", models.ResultLimits{MaxResultBytes: 42}, 1000, "max result bytes"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// The rows of the output are replaced with the rows read
+				output := *page
+				client := &pagedClient{pages: []*timestreamquery.QueryOutput{&output}}
+				ds := &timestreamDS{Client: client}
+
+				dr := ds.ExecuteQuery(context.Background(), models.QueryModel{WaitForResult: true, ResultLimits: tt.limits})
+				require.NoError(t, dr.Error)
+				assert.Equal(t, 1, client.index)
+				assert.Equal(t, tt.rows, dr.Frames[0].Rows())
+				if tt.limits.MaxRows > 0 {
+					assert.LessOrEqual(t, int64(dr.Frames[0].Rows()), tt.limits.MaxRows)
+				}
+				assert.Equal(t, "more", dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).NextToken)
+				require.Len(t, dr.Frames[0].Meta.Notices, 1)
+				assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, tt.limit)
+			})
+		}
+	})
+
+	t.Run("reads every page below the limits", func(t *testing.T) {
+		client := &MockClient{testFileNames: []string{"pagination-off_1", "pagination-off_2"}}
+		ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{
+			ResultLimits: models.ResultLimits{MaxPages: 10, MaxRows: 1000, MaxResultBytes: 1 << 20},
+		}}
+		dr := ds.ExecuteQuery(context.Background(), models.QueryModel{WaitForResult: true})
+		require.NoError(t, dr.Error)
+		assert.Equal(t, 2, client.index)
+		assert.Empty(t, dr.Frames[0].Meta.Notices)
+		assert.Empty(t, dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).NextToken)
+	})
+}
+
+func TestExecuteQuery_Stats(t *testing.T) {
+	page := func(rows int, scanned int64, next *string) *timestreamquery.QueryOutput {
+		out := &timestreamquery.QueryOutput{
+			ColumnInfo: []timestreamquerytypes.ColumnInfo{
+				{Name: aws.String("v"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeBigint}},
+			},
+			NextToken:   next,
+			QueryStatus: &timestreamquerytypes.QueryStatus{CumulativeBytesScanned: scanned, CumulativeBytesMetered: 10000000},
+		}
+		for range rows {
+			out.Rows = append(out.Rows, timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("1")}}})
+		}
+		return out
+	}
+	client := &pagedClient{pages: []*timestreamquery.QueryOutput{
+		page(0, 100, aws.String("1")), page(2, 300, aws.String("2")), page(3, 500, nil),
+	}}
+	ds := &timestreamDS{Client: client}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{WaitForResult: true})
+	require.NoError(t, dr.Error)
+
+	meta := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	require.NotNil(t, meta.Stats)
+	assert.Equal(t, int64(500), meta.Stats.BytesScanned)
+	assert.Equal(t, int64(10000000), meta.Stats.BytesMetered)
+	assert.Equal(t, 3, meta.Stats.Pages)
+	assert.Equal(t, 5, meta.Stats.Rows)
+	assert.Equal(t, int64(500), meta.Status.CumulativeBytesScanned)
+
+	stats := dr.Frames[0].Meta.Stats
+	require.Len(t, stats, 5)
+	assert.Equal(t, "Bytes scanned", stats[0].DisplayName)
+	assert.Equal(t, float64(500), stats[0].Value)
+	assert.Equal(t, "Pages", stats[2].DisplayName)
+	assert.Equal(t, float64(3), stats[2].Value)
+}
+
+// blockingClient returns a running query first, then blocks until the request is cancelled
+type blockingClient struct {
+	cancelled chan string
+}
+
+func (c *blockingClient) Query(ctx context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	if input.NextToken == nil {
+		return &timestreamquery.QueryOutput{QueryId: aws.String("running-query"), NextToken: aws.String("next")}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *blockingClient) CancelQuery(ctx context.Context, input *timestreamquery.CancelQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	c.cancelled <- *input.QueryId
+	return &timestreamquery.CancelQueryOutput{}, nil
+}
+
+func TestExecuteQuery_CancelsRunningQuery(t *testing.T) {
+	client := &blockingClient{cancelled: make(chan string, 1)}
+	ds := &timestreamDS{Client: client}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan backend.DataResponse)
+	go func() {
+		done <- ds.ExecuteQuery(ctx, models.QueryModel{RawQuery: "SELECT 1", WaitForResult: true})
+	}()
+	cancel()
+
+	dr := <-done
+	assert.ErrorIs(t, dr.Error, context.Canceled)
+
+	select {
+	case id := <-client.cancelled:
+		assert.Equal(t, "running-query", id)
+	case <-time.After(time.Second):
+		t.Fatal("query was not cancelled in timestream")
+	}
+}
+
+// racingClient returns the first page of a running query just as the request is cancelled
+type racingClient struct {
+	blockingClient
+	cancel context.CancelFunc
+}
+
+func (c *racingClient) Query(ctx context.Context, _ *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	c.cancel()
+	<-ctx.Done()
+	return &timestreamquery.QueryOutput{QueryId: aws.String("running-query"), NextToken: aws.String("next")}, nil
+}
+
+func TestExecuteQuery_CancelsRunningQueryWithoutWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &racingClient{blockingClient: blockingClient{cancelled: make(chan string, 1)}, cancel: cancel}
+	ds := &timestreamDS{Client: client}
+
+	dr := ds.ExecuteQuery(ctx, models.QueryModel{RawQuery: "SELECT 1"})
+	assert.ErrorIs(t, dr.Error, context.Canceled)
+
+	select {
+	case id := <-client.cancelled:
+		assert.Equal(t, "running-query", id)
+	case <-time.After(time.Second):
+		t.Fatal("query was not cancelled in timestream")
+	}
+}
+
+func TestExecuteQuery_Timeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings models.Duration
+		query    models.Duration
+	}{
+		{"datasource timeout", models.Duration(20 * time.Millisecond), 0},
+		{"query override", models.Duration(time.Hour), models.Duration(20 * time.Millisecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &blockingClient{cancelled: make(chan string, 1)}
+			ds := &timestreamDS{Client: client}
+			ds.Settings.QueryTimeout = tt.settings
+
+			dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+				RawQuery:      "SELECT 1",
+				WaitForResult: true,
+				QueryTimeout:  tt.query,
+			})
+			require.Error(t, dr.Error)
+			assert.ErrorIs(t, dr.Error, context.DeadlineExceeded)
+			assert.Contains(t, dr.Error.Error(), "query timed out after 20ms")
+			assert.Equal(t, backend.ErrorSourceDownstream, dr.ErrorSource)
+
+			select {
+			case id := <-client.cancelled:
+				assert.Equal(t, "running-query", id)
+			case <-time.After(time.Second):
+				t.Fatal("query was not cancelled in timestream")
+			}
+		})
+	}
+}
+
+func TestExecuteQuery_TimeoutCancelsSharedQuery(t *testing.T) {
+	client := &blockingClient{cancelled: make(chan string, 2)}
+	ds := &timestreamDS{Client: client}
+	query := models.QueryModel{
+		RawQuery:      "SELECT 1",
+		WaitForResult: true,
+		QueryTimeout:  models.Duration(50 * time.Millisecond),
+	}
+
+	first := make(chan backend.DataResponse)
+	go func() {
+		first <- ds.ExecuteQuery(context.Background(), query)
+	}()
+	waitForWaiters(t, &ds.flights, 1)
+
+	// The deadline belongs to the shared execution, not to either caller
+	for _, dr := range []backend.DataResponse{ds.ExecuteQuery(context.Background(), query), <-first} {
+		assert.ErrorIs(t, dr.Error, context.DeadlineExceeded)
+		assert.Contains(t, dr.Error.Error(), "query timed out after 50ms")
+	}
+
+	select {
+	case id := <-client.cancelled:
+		assert.Equal(t, "running-query", id)
+	case <-time.After(time.Second):
+		t.Fatal("query was not cancelled in timestream")
+	}
+	assert.Empty(t, client.cancelled)
+}
+
+func TestExecuteQuery_TimeShift(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		QueryId: aws.String("q"),
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("time"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeTimestamp}},
+		},
+		Rows: []timestreamquerytypes.Row{
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("2020-01-01 00:00:00.000000000")}}},
+		},
+	}}
+	ds := &timestreamDS{Client: client}
+
+	to := time.Date(2020, 1, 8, 0, 0, 0, 0, time.UTC)
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery:  "SELECT time WHERE $__timeFilter",
+		TimeRange: backend.TimeRange{From: to.Add(-time.Hour), To: to},
+		TimeShift: models.Duration(7 * 24 * time.Hour),
+	})
+	require.NoError(t, dr.Error)
+
+	from := to.Add(-time.Hour - 7*24*time.Hour)
+	assert.Equal(t,
+		fmt.Sprintf("SELECT time WHERE time BETWEEN from_milliseconds(%d) AND from_milliseconds(%d)", from.UnixMilli(), from.Add(time.Hour).UnixMilli()),
+		*client.calls.runQuery[0].QueryString)
+	v, ok := dr.Frames[0].Fields[0].ConcreteAt(0)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2020, 1, 8, 0, 0, 0, 0, time.UTC), v)
+}
+
+func TestExecuteQuery_DoesNotCancelFinishedQuery(t *testing.T) {
+	client := &MockClient{testFileNames: []string{"pagination-off_1", "pagination-off_2"}}
+	ds := &timestreamDS{Client: &cancelRecorder{MockClient: client}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dr := ds.ExecuteQuery(ctx, models.QueryModel{WaitForResult: true})
+	require.NoError(t, dr.Error)
+	cancel()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 0, ds.Client.(*cancelRecorder).calls)
+}
+
+type cancelRecorder struct {
+	*MockClient
+	calls int
+}
+
+func (c *cancelRecorder) CancelQuery(context.Context, *timestreamquery.CancelQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	c.calls++
+	return &timestreamquery.CancelQueryOutput{}, nil
+}
+
 // The following were formerly in executor_test.go
 
 func runTest(t *testing.T, names []string) *backend.DataResponse {
@@ -212,6 +725,12 @@ func runTest(t *testing.T, names []string) *backend.DataResponse {
 
 			// TODO: fix: https://github.com/grafana/grafana-plugin-sdk-go/issues/213
 			frame.Meta.Custom = nil
+
+			for i := range frame.Meta.Stats {
+				if frame.Meta.Stats[i].Unit == "ms" {
+					frame.Meta.Stats[i].Value = 0
+				}
+			}
 		}
 	}
 
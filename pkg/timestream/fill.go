@@ -0,0 +1,166 @@
+package timestream
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// Upper bound on the buckets added to a frame, so a tiny interval over a long range
+// can not exhaust memory
+const maxFillBuckets = 100_000
+
+// fillMissing adds a row for every bucket between the time range start and end that
+// has no data. The frame must have at most one row per time, like a wide time series.
+func fillMissing(frame *data.Frame, fill models.FillMissing, timeRange backend.TimeRange) (*data.Frame, error) {
+	timeIdx := slices.IndexFunc(frame.Fields, func(f *data.Field) bool { return f.Type().Time() })
+	if timeIdx < 0 {
+		return frame, nil
+	}
+	timeField := frame.Fields[timeIdx]
+
+	step := fill.Interval.Nanoseconds()
+	from := timeRange.From.UnixNano()
+	from -= from % step
+	to := timeRange.To.UnixNano()
+	if to >= from && (to-from)/step >= maxFillBuckets {
+		return nil, fmt.Errorf("more than %d buckets would be filled, use a larger $__timeGroup interval", maxFillBuckets)
+	}
+
+	// Source row of each time
+	rows := make(map[int64]int, timeField.Len())
+	for i := 0; i < timeField.Len(); i++ {
+		v, ok := timeField.ConcreteAt(i)
+		if !ok {
+			return nil, fmt.Errorf("missing buckets can not be filled for rows without a time")
+		}
+		t := v.(time.Time).UnixNano()
+		if _, dup := rows[t]; dup {
+			return nil, fmt.Errorf("missing buckets can not be filled when several rows share a time, use the time series format")
+		}
+		rows[t] = i
+	}
+
+	times := make([]int64, 0, len(rows))
+	for t := range rows {
+		times = append(times, t)
+	}
+	for t := from; t <= to; t += step {
+		if _, ok := rows[t]; !ok {
+			times = append(times, t)
+		}
+	}
+	slices.Sort(times)
+
+	fields := make([]*data.Field, len(frame.Fields))
+	for i, f := range frame.Fields {
+		if i == timeIdx {
+			fields[i] = data.NewFieldFromFieldType(f.Type(), len(times))
+			for j, t := range times {
+				fields[i].SetConcrete(j, time.Unix(0, t).UTC())
+			}
+		} else {
+			fields[i] = fillField(f, fill, times, rows)
+		}
+		fields[i].Name = f.Name
+		fields[i].Labels = f.Labels
+		fields[i].Config = f.Config
+	}
+
+	filled := data.NewFrame(frame.Name, fields...)
+	filled.RefID = frame.RefID
+	filled.Meta = frame.Meta
+	return filled, nil
+}
+
+// fillField copies the values of f into a nullable field with a row for every time,
+// filling the rows with no source according to the fill mode
+func fillField(f *data.Field, fill models.FillMissing, times []int64, rows map[int64]int) *data.Field {
+	out := data.NewFieldFromFieldType(f.Type().NullableType(), len(times))
+	numeric := f.Type().Numeric()
+
+	// Index in times of the next row with a value, used by linear filling
+	next := make([]int, len(times))
+	nextIdx := -1
+	for i := len(times) - 1; i >= 0; i-- {
+		next[i] = nextIdx
+		if r, ok := rows[times[i]]; ok {
+			if _, ok := f.ConcreteAt(r); ok {
+				nextIdx = i
+			}
+		}
+	}
+
+	prevIdx := -1
+	var prev interface{}
+	for i, t := range times {
+		if r, ok := rows[t]; ok {
+			if v, ok := f.ConcreteAt(r); ok {
+				out.SetConcrete(i, v)
+				prev = v
+				prevIdx = i
+			}
+			continue
+		}
+
+		switch fill.Mode {
+		case models.FillModePrevious:
+			if prev != nil {
+				out.SetConcrete(i, prev)
+			}
+		case models.FillModeValue:
+			if numeric {
+				setFloat(out, i, fill.Value)
+			}
+		case models.FillModeLinear:
+			if numeric && prevIdx >= 0 && next[i] >= 0 {
+				x0, y0 := times[prevIdx], floatAt(f, rows[times[prevIdx]])
+				x1, y1 := times[next[i]], floatAt(f, rows[times[next[i]]])
+				setFloat(out, i, y0+(y1-y0)*float64(t-x0)/float64(x1-x0))
+			}
+		}
+	}
+	return out
+}
+
+func floatAt(f *data.Field, idx int) float64 {
+	v, err := f.NullableFloatAt(idx)
+	if err != nil || v == nil {
+		return math.NaN()
+	}
+	return *v
+}
+
+// setFloat stores v in a nullable numeric field of any type
+func setFloat(f *data.Field, idx int, v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	switch f.Type().NonNullableType() {
+	case data.FieldTypeFloat64:
+		f.SetConcrete(idx, v)
+	case data.FieldTypeFloat32:
+		f.SetConcrete(idx, float32(v))
+	case data.FieldTypeInt64:
+		f.SetConcrete(idx, int64(math.Round(v)))
+	case data.FieldTypeInt32:
+		f.SetConcrete(idx, int32(math.Round(v)))
+	case data.FieldTypeInt16:
+		f.SetConcrete(idx, int16(math.Round(v)))
+	case data.FieldTypeInt8:
+		f.SetConcrete(idx, int8(math.Round(v)))
+	case data.FieldTypeUint64:
+		f.SetConcrete(idx, uint64(math.Round(v)))
+	case data.FieldTypeUint32:
+		f.SetConcrete(idx, uint32(math.Round(v)))
+	case data.FieldTypeUint16:
+		f.SetConcrete(idx, uint16(math.Round(v)))
+	case data.FieldTypeUint8:
+		f.SetConcrete(idx, uint8(math.Round(v)))
+	}
+}
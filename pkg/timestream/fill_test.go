@@ -0,0 +1,91 @@
+package timestream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFillMissing(t *testing.T) {
+	at := func(minutes int) time.Time { return time.Unix(int64(minutes*60), 0).UTC() }
+	timeRange := backend.TimeRange{From: at(0).Add(20 * time.Second), To: at(4)}
+	frame := func() *data.Frame {
+		return data.NewFrame("",
+			data.NewField("time", nil, []time.Time{at(1), at(4)}),
+			data.NewField("value", nil, []float64{10, 40}),
+			data.NewField("host", nil, []*string{ptr("a"), ptr("b")}),
+		)
+	}
+
+	tests := []struct {
+		mode   models.FillMode
+		values []*float64
+		hosts  []*string
+	}{
+		{models.FillModeNull, []*float64{nil, ptr(10.0), nil, nil, ptr(40.0)}, []*string{nil, ptr("a"), nil, nil, ptr("b")}},
+		{models.FillModePrevious, []*float64{nil, ptr(10.0), ptr(10.0), ptr(10.0), ptr(40.0)}, []*string{nil, ptr("a"), ptr("a"), ptr("a"), ptr("b")}},
+		{models.FillModeValue, []*float64{ptr(-1.0), ptr(10.0), ptr(-1.0), ptr(-1.0), ptr(40.0)}, []*string{nil, ptr("a"), nil, nil, ptr("b")}},
+		{models.FillModeLinear, []*float64{nil, ptr(10.0), ptr(20.0), ptr(30.0), ptr(40.0)}, []*string{nil, ptr("a"), nil, nil, ptr("b")}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			filled, err := fillMissing(frame(), models.FillMissing{Mode: tt.mode, Value: -1, Interval: time.Minute}, timeRange)
+			require.NoError(t, err)
+
+			require.Equal(t, 5, filled.Rows())
+			for i := 0; i < 5; i++ {
+				assert.Equal(t, at(i), filled.Fields[0].At(i))
+			}
+			assert.Equal(t, tt.values, valuesOf[*float64](filled.Fields[1]))
+			assert.Equal(t, tt.hosts, valuesOf[*string](filled.Fields[2]))
+		})
+	}
+
+	t.Run("integer values are rounded", func(t *testing.T) {
+		f := data.NewFrame("",
+			data.NewField("time", nil, []time.Time{at(0), at(3)}),
+			data.NewField("value", nil, []int64{0, 10}),
+		)
+		filled, err := fillMissing(f, models.FillMissing{Mode: models.FillModeLinear, Interval: time.Minute}, backend.TimeRange{From: at(0), To: at(3)})
+		require.NoError(t, err)
+		assert.Equal(t, []*int64{ptr(int64(0)), ptr(int64(3)), ptr(int64(7)), ptr(int64(10))}, valuesOf[*int64](filled.Fields[1]))
+	})
+
+	t.Run("frames without time are unchanged", func(t *testing.T) {
+		f := data.NewFrame("", data.NewField("value", nil, []float64{1}))
+		filled, err := fillMissing(f, models.FillMissing{Mode: models.FillModeNull, Interval: time.Minute}, timeRange)
+		require.NoError(t, err)
+		assert.Same(t, f, filled)
+	})
+
+	t.Run("several rows per time", func(t *testing.T) {
+		f := data.NewFrame("",
+			data.NewField("time", nil, []time.Time{at(1), at(1)}),
+			data.NewField("value", nil, []float64{1, 2}),
+		)
+		_, err := fillMissing(f, models.FillMissing{Mode: models.FillModeNull, Interval: time.Minute}, timeRange)
+		assert.Error(t, err)
+	})
+
+	t.Run("too many buckets", func(t *testing.T) {
+		_, err := fillMissing(frame(), models.FillMissing{Mode: models.FillModeNull, Interval: time.Millisecond}, backend.TimeRange{From: at(0), To: at(60 * 24)})
+		assert.Error(t, err)
+	})
+}
+
+func valuesOf[T any](f *data.Field) []T {
+	values := make([]T, f.Len())
+	for i := range values {
+		values[i] = f.At(i).(T)
+	}
+	return values
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
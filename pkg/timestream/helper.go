@@ -12,9 +12,20 @@ import (
 )
 
 // QueryResultToDataFrame creates a DataFrame from query results
-func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.FormatQueryOption) backend.DataResponse {
+func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.FormatQueryOption, opts models.ResultOptions) backend.DataResponse {
 	dr := backend.DataResponse{}
 	notices := []data.Notice{}
+	if opts.ExplodeArrays != models.ArrayModeDefault && opts.ExplodeArrays != models.ArrayModeJSON {
+		exploded, err := explodeArrays(res, opts.ExplodeArrays)
+		if err != nil {
+			notices = append(notices, data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     err.Error(),
+			})
+		} else {
+			res = exploded
+		}
+	}
 	builders := []*fieldBuilder{}
 	timeseriesColumns := []*fieldBuilder{}
 	cellParsingError := false
@@ -23,7 +34,22 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 
 	// Inspect the column structure
 	for index, columnMeta := range res.ColumnInfo {
-		b, err := getFieldBuilder(columnMeta.Type)
+		if opts.FlattenRows && columnMeta.Type.RowColumnInfo != nil {
+			fields, err := getFlatRowBuilders(*columnMeta.Name, columnMeta.Type.RowColumnInfo, nil, opts)
+			if err != nil {
+				notices = append(notices, data.Notice{
+					Severity: data.NoticeSeverityWarning,
+					Text:     err.Error(),
+				})
+				continue
+			}
+			for _, b := range fields {
+				b.columnIdx = index
+			}
+			builders = append(builders, fields...)
+			continue
+		}
+		b, err := getFieldBuilder(columnMeta.Type, opts)
 		if err != nil {
 			notices = append(notices, data.Notice{
 				Severity: data.NoticeSeverityWarning,
@@ -43,8 +69,9 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 
 	if hasTimeseries {
 		// Each row is a new series
+		seriesFrames := []*data.Frame{}
 		for _, timeseriesColumn := range timeseriesColumns {
-			for _, series := range res.Rows {
+			for rowIdx, series := range res.Rows {
 				tv := series.Data[timeseriesColumn.columnIdx].TimeSeriesValue
 				nv := series.Data[timeseriesColumn.columnIdx].NullValue
 				isNullDataPoint := nv != nil && *nv
@@ -52,30 +79,81 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 					return backend.ErrorResponseWithErrorSource(backend.PluginErrorf("expecting timeseries column at: %d", timeseriesColumn.columnIdx))
 				}
 
-				length := len(tv)
-				tf := data.NewFieldFromFieldType(data.FieldTypeTime, length)
-				vf := data.NewFieldFromFieldType(timeseriesColumn.fieldType, length)
+				tf := data.NewFieldFromFieldType(data.FieldTypeTime, 0)
+				vf := data.NewFieldFromFieldType(timeseriesColumn.fieldType, 0)
 				tf.Name = "time"
 				vf.Name = timeseriesColumn.name
+				if timeseriesColumn.config != nil {
+					vf.Config = timeseriesColumn.config
+				}
 				vf.Labels = data.Labels{}
 				for _, builder := range builders {
-					val := series.Data[builder.columnIdx].ScalarValue
+					val := builder.datum(series.Data[builder.columnIdx]).ScalarValue
 					if !builder.timeseries && val != nil {
 						vf.Labels[builder.name] = *val
 					}
 				}
 
-				for i := 0; i < length; i++ {
-					t, _ := time.Parse("2006-01-02 15:04:05.99999999", *tv[i].Time)
-					v, _ := timeseriesColumn.parser(*tv[i].Value)
-					tf.Set(i, t)
-					vf.Set(i, v)
+				for i, point := range tv {
+					// Points without a valid time are dropped, a zero time would plot at 1970
+					var t time.Time
+					var err error
+					if point.Time == nil {
+						err = fmt.Errorf("missing time")
+					} else {
+						t, err = parseTimestamp(*point.Time)
+					}
+					if err != nil {
+						if !cellParsingError {
+							notices = append(notices, parsingNotice(rowIdx, timeseriesColumn.columnIdx, i, err))
+						}
+						cellParsingError = true
+						continue
+					}
+					var v interface{}
+					if point.Value != nil {
+						if v, err = timeseriesColumn.parser(*point.Value); err != nil {
+							if !cellParsingError {
+								notices = append(notices, parsingNotice(rowIdx, timeseriesColumn.columnIdx, i, err))
+							}
+							cellParsingError = true
+							v = nil
+						}
+					}
+					tf.Append(t)
+					vf.Append(v)
 				}
 
 				// Add the series as a frame
-				dr.Frames = append(dr.Frames, data.NewFrame("", tf, vf))
+				seriesFrames = append(seriesFrames, data.NewFrame("", tf, vf))
 			}
 		}
+
+		var merged *data.Frame
+		var mergeErr error
+		switch {
+		case len(seriesFrames) == 0:
+		case format == models.FormatOptionTimeSeriesWide:
+			merged, mergeErr = mergeSeriesWide(seriesFrames)
+		case format == models.FormatOptionTimeSeriesLong:
+			labels := make([]string, len(builders))
+			for i, builder := range builders {
+				labels[i] = builder.name
+			}
+			merged, mergeErr = mergeSeriesLong(seriesFrames, labels)
+		}
+		if merged != nil {
+			dr.Frames = append(dr.Frames, merged)
+		} else {
+			// A frame per series, also when merging them would lose points
+			dr.Frames = append(dr.Frames, seriesFrames...)
+		}
+		if mergeErr != nil {
+			notices = append(notices, data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     fmt.Sprintf("The series were not merged into one frame because %s. A frame is returned for each series.", mergeErr.Error()),
+			})
+		}
 	} else {
 		fields := []*data.Field{}
 		for _, builder := range builders {
@@ -86,7 +164,7 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 			}
 			for i := 0; i < length; i++ {
 				row := res.Rows[i]
-				v, err := builder.parser(row.Data[builder.columnIdx])
+				v, err := builder.parser(builder.datum(row.Data[builder.columnIdx]))
 				if err != nil {
 					if !cellParsingError {
 						notices = append(notices, data.Notice{
@@ -113,7 +191,7 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 
 		frame := data.NewFrame("", fields...)
 
-		if length > 0 && format == models.FormatOptionTimeSeries {
+		if length > 0 && (format == models.FormatOptionTimeSeries || format == models.FormatOptionTimeSeriesWide) {
 			if frame.TimeSeriesSchema().Type == data.TimeSeriesTypeLong {
 				var err error
 				frame, err = data.LongToWide(frame, &data.FillMissing{
@@ -152,3 +230,31 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 	dr.Frames[0].Meta.Custom = meta
 	return dr
 }
+
+// parsingNotice reports a time series point that could not be read
+func parsingNotice(row, column, point int, err error) data.Notice {
+	return data.Notice{
+		Severity: data.NoticeSeverityError,
+		Text:     fmt.Sprintf("Error parsing: row:%d, column:%d, point:%d: %s", row, column, point, err.Error()),
+	}
+}
+
+// shiftFrames moves every time value forward, so results of a time shifted query
+// line up with the dashboard time range
+func shiftFrames(frames data.Frames, shift time.Duration) {
+	if shift == 0 {
+		return
+	}
+	for _, frame := range frames {
+		for _, field := range frame.Fields {
+			if !field.Type().Time() {
+				continue
+			}
+			for i := 0; i < field.Len(); i++ {
+				if v, ok := field.ConcreteAt(i); ok {
+					field.SetConcrete(i, v.(time.Time).Add(shift))
+				}
+			}
+		}
+	}
+}
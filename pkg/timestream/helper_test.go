@@ -3,11 +3,13 @@ package timestream
 import (
 	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
 	"github.com/grafana/timestream-datasource/pkg/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestQueryResultToDataFrame(t *testing.T) {
@@ -75,7 +77,7 @@ func TestQueryResultToDataFrame(t *testing.T) {
 	}
 
 	t.Run("table format", func(t *testing.T) {
-		res := QueryResultToDataFrame(input, models.FormatOptionTable)
+		res := QueryResultToDataFrame(input, models.FormatOptionTable, models.ResultOptions{})
 
 		// Assert that it returns one frame with four fields
 		assert.Equal(t, 1, len(res.Frames))
@@ -87,7 +89,7 @@ func TestQueryResultToDataFrame(t *testing.T) {
 	})
 
 	t.Run("timeseries format", func(t *testing.T) {
-		res := QueryResultToDataFrame(input, models.FormatOptionTimeSeries)
+		res := QueryResultToDataFrame(input, models.FormatOptionTimeSeries, models.ResultOptions{})
 		// Assert that it returns one frame with three fields
 		assert.Equal(t, 1, len(res.Frames))
 		assert.Equal(t, 3, len(res.Frames[0].Fields))
@@ -108,10 +110,172 @@ func TestQueryResultToDataFrame(t *testing.T) {
 		input.Rows = []timestreamquerytypes.Row{}
 		inputWithNoRows := input
 		inputWithNoRows.Rows = []timestreamquerytypes.Row{}
-		res := QueryResultToDataFrame(inputWithNoRows, models.FormatOptionTimeSeries)
+		res := QueryResultToDataFrame(inputWithNoRows, models.FormatOptionTimeSeries, models.ResultOptions{})
 		// Assert that it returns one frame with no fields
 		assert.Equal(t, 1, len(res.Frames))
 		assert.Equal(t, 4, len(res.Frames[0].Fields))
 		assert.Equal(t, 0, res.Frames[0].Fields[0].Len())
 	})
 }
+
+func TestQueryResultToDataFrame_Nanoseconds(t *testing.T) {
+	t.Run("timestamps keep every digit", func(t *testing.T) {
+		for value, nanos := range map[string]int{
+			"2021-03-14 09:52:44":           0,
+			"2021-03-14 09:52:44.1":         100000000,
+			"2021-03-14 09:52:44.12345678":  123456780,
+			"2021-03-14 09:52:44.123456789": 123456789,
+		} {
+			v, err := parseTimestamp(value)
+			require.NoError(t, err)
+			assert.Equal(t, nanos, v.Nanosecond(), value)
+		}
+		for _, value := range []string{"2021-03-14 09:52:44.", "2021-03-14 09:52:44.1234567891", "2021-03-14 09:52:44.12a", "2021-03-14"} {
+			_, err := parseTimestamp(value)
+			assert.Error(t, err, value)
+		}
+	})
+
+	t.Run("time values", func(t *testing.T) {
+		v, err := datumParserTime(timestreamquerytypes.Datum{ScalarValue: aws.String("09:52:44.000000001")})
+		require.NoError(t, err)
+		assert.Equal(t, 1, v.(*time.Time).Nanosecond())
+		assert.Equal(t, 1970, v.(*time.Time).Year())
+	})
+
+	t.Run("time series points", func(t *testing.T) {
+		input := &timestreamquery.QueryOutput{
+			ColumnInfo: []timestreamquerytypes.ColumnInfo{
+				{Name: aws.String("host"), Type: &timestreamquerytypes.Type{ScalarType: "VARCHAR"}},
+				{Name: aws.String("cpu"), Type: &timestreamquerytypes.Type{
+					TimeSeriesMeasureValueColumnInfo: &timestreamquerytypes.ColumnInfo{
+						Type: &timestreamquerytypes.Type{ScalarType: "DOUBLE"},
+					},
+				}},
+			},
+			Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{
+				{ScalarValue: aws.String("a")},
+				{TimeSeriesValue: []timestreamquerytypes.TimeSeriesDataPoint{
+					{Time: aws.String("2021-03-14 09:52:44.000000001"), Value: &timestreamquerytypes.Datum{ScalarValue: aws.String("1.5")}},
+					{Time: aws.String("not a time"), Value: &timestreamquerytypes.Datum{ScalarValue: aws.String("2")}},
+					{Time: aws.String("2021-03-14 09:52:44.000000003"), Value: &timestreamquerytypes.Datum{ScalarValue: aws.String("x")}},
+				}},
+			}}},
+		}
+		res := QueryResultToDataFrame(input, models.FormatOptionTimeSeries, models.ResultOptions{})
+		require.NoError(t, res.Error)
+		require.Len(t, res.Frames, 1)
+		frame := res.Frames[0]
+		require.Equal(t, 2, frame.Rows())
+		assert.Equal(t, 1, frame.Fields[0].At(0).(time.Time).Nanosecond())
+		assert.Equal(t, 3, frame.Fields[0].At(1).(time.Time).Nanosecond())
+		assert.Equal(t, 1.5, *frame.Fields[1].At(0).(*float64))
+		assert.Nil(t, frame.Fields[1].At(1))
+
+		require.Len(t, frame.Meta.Notices, 1)
+		assert.Contains(t, frame.Meta.Notices[0].Text, "row:0, column:1, point:1")
+	})
+}
+
+func TestQueryResultToDataFrame_Intervals(t *testing.T) {
+	input := &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("recovery"), Type: &timestreamquerytypes.Type{ScalarType: "INTERVAL_DAY_TO_SECOND"}},
+			{Name: aws.String("age"), Type: &timestreamquerytypes.Type{ScalarType: "INTERVAL_YEAR_TO_MONTH"}},
+		},
+		Rows: []timestreamquerytypes.Row{
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("0 00:00:01.500000001")}, {ScalarValue: aws.String("1-6")}}},
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("-1 02:00:00.000000000")}, {ScalarValue: aws.String("-0-3")}}},
+			{Data: []timestreamquerytypes.Datum{{NullValue: aws.Bool(true)}, {NullValue: aws.Bool(true)}}},
+		},
+	}
+
+	t.Run("as numbers", func(t *testing.T) {
+		res := QueryResultToDataFrame(input, models.FormatOptionTable, models.ResultOptions{})
+		require.NoError(t, res.Error)
+		fields := res.Frames[0].Fields
+		assert.Equal(t, "ms", fields[0].Config.Unit)
+		assert.InDelta(t, 1500.000001, *fields[0].At(0).(*float64), 1e-9)
+		assert.Equal(t, -93600000.0, *fields[0].At(1).(*float64))
+		assert.Nil(t, fields[0].At(2))
+		assert.Equal(t, "months", fields[1].Config.Unit)
+		assert.Equal(t, int64(18), *fields[1].At(0).(*int64))
+		assert.Equal(t, int64(-3), *fields[1].At(1).(*int64))
+		assert.Nil(t, fields[1].At(2))
+	})
+
+	t.Run("as strings", func(t *testing.T) {
+		res := QueryResultToDataFrame(input, models.FormatOptionTable, models.ResultOptions{IntervalsAsStrings: true})
+		require.NoError(t, res.Error)
+		assert.Equal(t, "0 00:00:01.500000001", *res.Frames[0].Fields[0].At(0).(*string))
+		assert.Equal(t, "1-6", *res.Frames[0].Fields[1].At(0).(*string))
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		for _, value := range []string{"1", "x 00:00:00", "1 25:00:00"} {
+			_, err := datumParserDayToSecond(timestreamquerytypes.Datum{ScalarValue: aws.String(value)})
+			assert.Error(t, err, value)
+		}
+		for _, value := range []string{"1", "a-1", "1-b"} {
+			_, err := datumParserYearToMonth(timestreamquerytypes.Datum{ScalarValue: aws.String(value)})
+			assert.Error(t, err, value)
+		}
+	})
+}
+
+func TestQueryResultToDataFrame_FlattenRows(t *testing.T) {
+	scalar := func(t timestreamquerytypes.ScalarType) *timestreamquerytypes.Type {
+		return &timestreamquerytypes.Type{ScalarType: t}
+	}
+	input := &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("host"), Type: scalar("VARCHAR")},
+			{Name: aws.String("stats"), Type: &timestreamquerytypes.Type{RowColumnInfo: []timestreamquerytypes.ColumnInfo{
+				{Name: aws.String("min"), Type: scalar("DOUBLE")},
+				{Name: aws.String("max"), Type: scalar("DOUBLE")},
+				{Name: aws.String("p"), Type: &timestreamquerytypes.Type{RowColumnInfo: []timestreamquerytypes.ColumnInfo{
+					{Name: aws.String("p99"), Type: scalar("BIGINT")},
+				}}},
+			}}},
+		},
+		Rows: []timestreamquerytypes.Row{
+			{Data: []timestreamquerytypes.Datum{
+				{ScalarValue: aws.String("a")},
+				{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{
+					{ScalarValue: aws.String("1.5")},
+					{ScalarValue: aws.String("9")},
+					{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("7")}}}},
+				}}},
+			}},
+			{Data: []timestreamquerytypes.Datum{
+				{ScalarValue: aws.String("b")},
+				{NullValue: aws.Bool(true)},
+			}},
+		},
+	}
+
+	t.Run("flattened", func(t *testing.T) {
+		res := QueryResultToDataFrame(input, models.FormatOptionTable, models.ResultOptions{FlattenRows: true})
+		require.NoError(t, res.Error)
+		fields := res.Frames[0].Fields
+		require.Len(t, fields, 4)
+		assert.Equal(t, []string{"host", "stats.min", "stats.max", "stats.p.p99"},
+			[]string{fields[0].Name, fields[1].Name, fields[2].Name, fields[3].Name})
+		assert.Equal(t, 1.5, *fields[1].At(0).(*float64))
+		assert.Equal(t, 9.0, *fields[2].At(0).(*float64))
+		assert.Equal(t, int64(7), *fields[3].At(0).(*int64))
+		for _, f := range fields[1:] {
+			assert.Nil(t, f.At(1))
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		input := *input
+		input.Rows = input.Rows[:1]
+		res := QueryResultToDataFrame(&input, models.FormatOptionTable, models.ResultOptions{})
+		require.NoError(t, res.Error)
+		fields := res.Frames[0].Fields
+		require.Len(t, fields, 2)
+		assert.JSONEq(t, `{"min":1.5,"max":9,"p":{"p99":7}}`, fields[1].At(0).(string))
+	})
+}
@@ -0,0 +1,299 @@
+package timestream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const macroPrefix = "$__"
+
+// Custom macros may use other macros, up to this depth
+const maxMacroDepth = 10
+
+// Interpolate expands the macros in the raw query. Macros are written as $__name or
+// $__name(arg1, arg2), where arguments may hold nested parentheses, quoted strings
+// and other macros.
+func Interpolate(model models.QueryModel, settings models.DatasourceSettings) (string, error) {
+	macros, err := newMacroSet(settings.Macros)
+	if err != nil {
+		return model.RawQuery, backend.DownstreamError(err)
+	}
+	query, _, err := macros.interpolate(model, settings)
+	return query, err
+}
+
+// interpolate is Interpolate with macros registered beforehand. It also returns the
+// gap filling requested by $__timeGroup, if any.
+func (t *macroSet) interpolate(model models.QueryModel, settings models.DatasourceSettings) (string, *models.FillMissing, error) {
+	if t == nil {
+		t = builtinMacros
+	}
+	model.Interval = settings.AdjustInterval(model.Interval)
+	p := &macroParser{query: model.RawQuery, model: &model, settings: settings, macros: t}
+	query, err := p.expand(0, len(p.query))
+	if err != nil {
+		return model.RawQuery, nil, backend.DownstreamError(err)
+	}
+	return query, model.FillMissing, nil
+}
+
+type macroParser struct {
+	query    string
+	settings models.DatasourceSettings
+	macros   *macroSet
+
+	// A copy of the query model, which macros may record options on
+	model *models.QueryModel
+
+	// Nesting level of custom macros
+	depth int
+}
+
+// expand returns query[start:end] with its macros replaced
+func (p *macroParser) expand(start, end int) (string, error) {
+	var sb strings.Builder
+	for i := start; i < end; {
+		pos := p.nextMacro(i, end)
+		if pos < 0 {
+			sb.WriteString(p.query[i:end])
+			break
+		}
+		sb.WriteString(p.query[i:pos])
+
+		if quote := p.query[pos]; quote == '\'' || quote == '"' {
+			closing := p.skipLiteral(pos, end) - 1
+			var inner string
+			var err error
+			if p.isQuotedMacro(pos, closing+1) {
+				inner, err = p.expand(pos+1, closing)
+			} else {
+				inner, err = p.expandVariables(pos+1, closing)
+			}
+			if err != nil {
+				return "", err
+			}
+			sb.WriteByte(quote)
+			sb.WriteString(inner)
+			sb.WriteByte(quote)
+			i = closing + 1
+			continue
+		}
+
+		if strings.HasPrefix(p.query[pos:end], variablePrefix) {
+			value, next, err := p.variable(pos, end)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			i = next
+			continue
+		}
+
+		name := p.macroName(pos+len(macroPrefix), end)
+		if name == "" {
+			// Not ours, for example a Grafana variable
+			sb.WriteString(macroPrefix)
+			i = pos + len(macroPrefix)
+			continue
+		}
+		i = pos + len(macroPrefix) + len(name)
+
+		var args []string
+		if i < end && p.query[i] == '(' {
+			spans, closing, err := p.scanArgs(i, end)
+			if err != nil {
+				return "", err
+			}
+			for _, span := range spans {
+				arg, err := p.expand(span[0], span[1])
+				if err != nil {
+					return "", err
+				}
+				args = append(args, strings.TrimSpace(arg))
+			}
+			i = closing + 1
+		}
+
+		replacement, err := p.call(name, args)
+		if err != nil {
+			return "", p.errorAt(pos, fmt.Errorf("%s%s: %w", macroPrefix, name, err))
+		}
+		sb.WriteString(replacement)
+	}
+	return sb.String(), nil
+}
+
+// call expands one macro. Custom macros are expanded again, as they may use other macros.
+func (p *macroParser) call(name string, args []string) (string, error) {
+	custom, ok := p.macros.custom[name]
+	if !ok {
+		return macroFuncs[name](p.model, p.settings, args)
+	}
+	sql, err := custom.expand(args)
+	if err != nil {
+		return "", err
+	}
+	if p.depth >= maxMacroDepth {
+		return "", fmt.Errorf("macros are nested more than %d levels deep", maxMacroDepth)
+	}
+	nested := &macroParser{query: sql, model: p.model, settings: p.settings, macros: p.macros, depth: p.depth + 1}
+	return nested.expand(0, len(sql))
+}
+
+// nextMacro returns the position of the next macro prefix or braced variable that
+// is not inside a quoted string or a comment, or -1. Quoted strings holding nothing
+// but a macro, like '$__measure', or holding braced variables, like
+// '${__from:date:iso}', are still expanded and returned at their opening quote.
+func (p *macroParser) nextMacro(start, end int) int {
+	for i := start; i < end; {
+		if next := p.skipLiteral(i, end); next != i {
+			if next < 0 {
+				return -1
+			}
+			if p.isQuotedMacro(i, next) || p.hasQuotedVariable(i, next) {
+				return i
+			}
+			i = next
+			continue
+		}
+		if strings.HasPrefix(p.query[i:end], macroPrefix) || strings.HasPrefix(p.query[i:end], variablePrefix) {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// isQuotedMacro reports whether query[start:end] is a quoted macro without arguments
+func (p *macroParser) isQuotedMacro(start, end int) bool {
+	if q := p.query[start]; q != '\'' && q != '"' {
+		return false
+	}
+	inner := p.query[start+1 : end-1]
+	if !strings.HasPrefix(inner, macroPrefix) {
+		return false
+	}
+	name := p.macroName(start+1+len(macroPrefix), end-1)
+	return name != "" && len(macroPrefix)+len(name) == len(inner)
+}
+
+// hasQuotedVariable reports whether query[start:end] is a quoted string holding a
+// braced variable, which the browser would have replaced as well
+func (p *macroParser) hasQuotedVariable(start, end int) bool {
+	if q := p.query[start]; q != '\'' && q != '"' {
+		return false
+	}
+	return strings.Contains(p.query[start:end], variablePrefix)
+}
+
+// macroName returns the macro named by the identifier at start, or "" when the
+// identifier is not a macro, e.g. $__today
+func (p *macroParser) macroName(start, end int) string {
+	i := start
+	for i < end && isIdentChar(p.query[i]) {
+		i++
+	}
+	if ident := p.query[start:i]; p.macros.has(ident) {
+		return ident
+	}
+	return ""
+}
+
+// scanArgs reads the argument list opened at open and returns the bounds of each
+// argument and the position of the closing parenthesis
+func (p *macroParser) scanArgs(open, end int) ([][2]int, int, error) {
+	var spans [][2]int
+	depth := 0
+	start := open + 1
+	for i := open; i < end; i++ {
+		if next := p.skipLiteral(i, end); next != i {
+			if next < 0 {
+				return nil, 0, p.errorAt(i, p.unterminated(i))
+			}
+			i = next - 1
+			continue
+		}
+		switch p.query[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				if len(spans) > 0 || strings.TrimSpace(p.query[start:i]) != "" {
+					spans = append(spans, [2]int{start, i})
+				}
+				return spans, i, nil
+			}
+		case ',':
+			if depth == 1 {
+				spans = append(spans, [2]int{start, i})
+				start = i + 1
+			}
+		}
+	}
+	return nil, 0, p.errorAt(open, fmt.Errorf("missing closing parenthesis"))
+}
+
+// skipLiteral returns the position after the string literal, quoted identifier or
+// comment starting at i, i when none starts there, and -1 when it is not terminated.
+// Macros are not expanded inside any of them.
+func (p *macroParser) skipLiteral(i, end int) int {
+	rest := p.query[i:end]
+	switch {
+	case rest[0] == '\'' || rest[0] == '"':
+		closing := p.skipQuoted(i, end)
+		if closing < 0 {
+			return -1
+		}
+		return closing + 1
+	case strings.HasPrefix(rest, "--"):
+		if nl := strings.IndexByte(rest, '\n'); nl >= 0 {
+			return i + nl
+		}
+		return end
+	case strings.HasPrefix(rest, "/*"):
+		if closing := strings.Index(rest[2:], "*/"); closing >= 0 {
+			return i + 2 + closing + 2
+		}
+		return -1
+	}
+	return i
+}
+
+func (p *macroParser) unterminated(i int) error {
+	if p.query[i] == '/' {
+		return fmt.Errorf("unterminated comment")
+	}
+	return fmt.Errorf("unterminated quoted string")
+}
+
+// skipQuoted returns the position of the quote closing the one at start, or -1.
+// Two quotes in a row are an escaped quote, not the end of the string.
+func (p *macroParser) skipQuoted(start, end int) int {
+	quote := p.query[start]
+	for i := start + 1; i < end; i++ {
+		if p.query[i] != quote {
+			continue
+		}
+		if i+1 < end && p.query[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// errorAt adds the line and column of pos to err
+func (p *macroParser) errorAt(pos int, err error) error {
+	line := 1 + strings.Count(p.query[:pos], "\n")
+	column := pos - strings.LastIndex(p.query[:pos], "\n")
+	return fmt.Errorf("%w (line %d, column %d)", err, line, column)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,131 @@
+package timestream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolateParser(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.UnixMilli(1500376552001),
+		To:   time.UnixMilli(1500376552002),
+	}
+	settings := models.DatasourceSettings{DefaultDatabase: "db"}
+
+	tests := []struct {
+		name   string
+		sql    string
+		expect string
+	}{
+		{
+			"time filter on a column",
+			`WHERE $__timeFilter(event_time)`,
+			`WHERE event_time BETWEEN from_milliseconds(1500376552001) AND from_milliseconds(1500376552002)`,
+		},
+		{
+			"time filter without arguments",
+			`WHERE $__timeFilter() AND $__timeFilter`,
+			`WHERE time BETWEEN from_milliseconds(1500376552001) AND from_milliseconds(1500376552002) AND time BETWEEN from_milliseconds(1500376552001) AND from_milliseconds(1500376552002)`,
+		},
+		{
+			"nested parentheses",
+			`$__timeGroup(date_trunc('hour', (time)), 1h)`,
+			`bin(date_trunc('hour', (time)), 1h)`,
+		},
+		{
+			"quoted strings with separators",
+			`$__timeFilter("time, (really)")`,
+			`"time, (really)" BETWEEN from_milliseconds(1500376552001) AND from_milliseconds(1500376552002)`,
+		},
+		{
+			"escaped quotes",
+			`$__timeGroup(coalesce(time, 'it''s, )'), 1m)`,
+			`bin(coalesce(time, 'it''s, )'), 1m)`,
+		},
+		{
+			"macros in arguments",
+			`$__timeGroup(time, $__interval)`,
+			`bin(time, 1m)`,
+		},
+		{
+			"macro followed by a parenthesis in sql",
+			`FROM $__database.t WHERE time > from_milliseconds($__timeFrom)`,
+			`FROM db.t WHERE time > from_milliseconds(1500376552001)`,
+		},
+		{
+			"unknown macros are left alone",
+			`WHERE user = ${__user.login} AND $__unknown(x)`,
+			`WHERE user = ${__user.login} AND $__unknown(x)`,
+		},
+		{
+			"macro names match whole identifiers",
+			`SELECT $__today, $__to_char(time), $__interval_ms, $__timeFromX`,
+			`SELECT $__today, $__to_char(time), 60000ms, $__timeFromX`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, TimeRange: timeRange, Interval: time.Minute}
+			text, err := Interpolate(query, settings)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, text)
+		})
+	}
+}
+
+func TestInterpolateParser_LiteralsAndComments(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    string
+		expect string
+	}{
+		{"string literal", `SELECT 'cost in $__interval', $__interval`, `SELECT 'cost in $__interval', 60000ms`},
+		{"escaped quote", `SELECT 'it''s $__interval', $__interval`, `SELECT 'it''s $__interval', 60000ms`},
+		{"quoted identifier", `SELECT "per $__interval" FROM t`, `SELECT "per $__interval" FROM t`},
+		{"quoted macro", `FROM "$__database"."$__table" WHERE measure_name = '$__measure'`, `FROM "db"."tbl" WHERE measure_name = 'cpu'`},
+		{"line comment", "-- GROUP BY $__interval\nGROUP BY $__interval", "-- GROUP BY $__interval\nGROUP BY 60000ms"},
+		{"line comment at the end", "GROUP BY $__interval -- not $__interval", "GROUP BY 60000ms -- not $__interval"},
+		{"block comment", "/* $__timeFilter(\n $__interval */ $__interval", "/* $__timeFilter(\n $__interval */ 60000ms"},
+		{"unterminated literal", `SELECT $__interval, 'abc $__interval`, `SELECT 60000ms, 'abc $__interval`},
+		{"unterminated comment", `SELECT $__interval /* $__interval`, `SELECT 60000ms /* $__interval`},
+		{"literal in arguments", `$__timeGroup(coalesce(time, '$__interval)'), 1m)`, `bin(coalesce(time, '$__interval)'), 1m)`},
+		{"comment in arguments", "$__timeGroup(time /* ) */, 1m)", "bin(time /* ) */, 1m)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, Interval: time.Minute}
+			text, err := Interpolate(query, models.DatasourceSettings{DefaultDatabase: "db", DefaultTable: "tbl", DefaultMeasure: "cpu"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, text)
+		})
+	}
+}
+
+func TestInterpolateParser_Errors(t *testing.T) {
+	tests := []struct {
+		sql string
+		err string
+	}{
+		{"SELECT $__timeFilter(time", "missing closing parenthesis (line 1, column 21)"},
+		{"SELECT *\nWHERE $__timeFilter(time, 'a", "unterminated quoted string (line 2, column 27)"},
+		{"SELECT *\n  FROM t\n  WHERE $__measure(1)", "$__measure: expects no arguments, got 1 (line 3, column 9)"},
+		{"$__timeFilter(a, 'UTC', b)", "$__timeFilter: expects an optional time column and timezone, got 3 arguments (line 1, column 1)"},
+		{"$__timeGroup(time /* 5m)", "unterminated comment (line 1, column 19)"},
+		{"$__timeGroup(time, 5m, $__interval(x))", "$__interval: expects no arguments, got 1 (line 1, column 24)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, Interval: time.Minute}
+			text, err := Interpolate(query, models.DatasourceSettings{})
+			require.Error(t, err)
+			assert.Equal(t, tt.err, err.Error())
+			assert.True(t, backend.IsDownstreamError(err))
+			assert.Equal(t, tt.sql, text)
+		})
+	}
+}
@@ -2,55 +2,268 @@ package timestream
 
 import (
 	"fmt"
-	"maps"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/timestream-datasource/pkg/models"
 )
 
-// TODO: consider refactoring sqlutil.Interpolate to be more generic and using that instead
-
-type macroFunc func(models.QueryModel, models.DatasourceSettings) (string, error)
+// macroFunc expands a macro, args are set when it is called as $__name(arg1, arg2).
+// Macros may record options on the model, like the fill mode of $__timeGroup.
+type macroFunc func(*models.QueryModel, models.DatasourceSettings, []string) (string, error)
 
 var macroFuncs = map[string]macroFunc{
 	"timeFilter":      macroTimeFilter,
+	"from":            withoutArgs(macroFrom),
+	"to":              withoutArgs(macroTo),
+	"range":           withoutArgs(macroRange),
+	"range_s":         withoutArgs(macroRangeSeconds),
+	"range_ms":        withoutArgs(macroRangeMs),
 	"timeFrom":        macroTimeFrom,
 	"timeTo":          macroTimeTo,
-	"interval":        macroInterval,
-	"interval_ms":     macroInterval,
-	"interval_raw_ms": macroIntervalRaw,
-	"now_ms":          macroNow,
-	"database":        macroDatabase,
-	"table":           macroTable,
-	"measure":         macroMeasure,
+	"timezone":        withoutArgs(macroTimezone),
+	"timeGroup":       macroTimeGroup,
+	"timeFilterShift": macroTimeFilterShift,
+	"timeFromShift":   macroTimeFromShift,
+	"timeToShift":     macroTimeToShift,
+	"dimensionFilter": macroDimensionFilter,
+	"in":              macroIn,
+	"adhocFilters":    withoutArgs(macroAdhocFilters),
+	"interval":        withoutArgs(macroInterval),
+	"interval_ms":     withoutArgs(macroInterval),
+	"interval_raw_ms": withoutArgs(macroIntervalRaw),
+	"rate_interval":   withoutArgs(macroRateInterval),
+	"now_ms":          withoutArgs(macroNow),
+	"database":        withoutArgs(macroDatabase),
+	"table":           withoutArgs(macroTable),
+	"measure":         withoutArgs(macroMeasure),
+}
+
+// macroSet is the set of macros a datasource expands: the built-in macros and
+// the macros defined in the datasource settings
+type macroSet struct {
+	custom map[string]customMacro
+}
+
+// customMacro is a SQL fragment from the settings, with $1, $2... replaced by the arguments
+type customMacro struct {
+	sql    string
+	params int
 }
 
-var macroKeys []string
+var (
+	builtinMacros *macroSet
+
+	macroPlaceholder = regexp.MustCompile(`\$(\d+)`)
+)
 
 func init() {
-	// sort macro keys longest first, so shorter keys don't clobber longer keys
-	// they're a prefix of
-	macroKeys = slices.Collect(maps.Keys(macroFuncs))
-	slices.SortFunc(macroKeys, func(a, b string) int { return len(b) - len(a) })
+	builtinMacros, _ = newMacroSet(nil)
+}
+
+// newMacroSet registers the macros defined in the settings next to the built-in ones
+func newMacroSet(definitions map[string]string) (*macroSet, error) {
+	t := &macroSet{custom: map[string]customMacro{}}
+	for name, sql := range definitions {
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return r > unicode.MaxASCII || !isIdentChar(byte(r)) }) >= 0 {
+			return nil, fmt.Errorf("invalid macro name %q, use letters, digits and underscores", name)
+		}
+		if _, ok := macroFuncs[name]; ok {
+			return nil, fmt.Errorf("macro %q is built in and can not be redefined", name)
+		}
+		m := customMacro{sql: sql}
+		for _, match := range macroPlaceholder.FindAllStringSubmatch(sql, -1) {
+			n, err := strconv.Atoi(match[1])
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("macro %q: invalid placeholder %s, parameters start at $1", name, match[0])
+			}
+			m.params = max(m.params, n)
+		}
+		t.custom[name] = m
+	}
+	return t, nil
 }
 
-func macroTimeFilter(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
-	from := model.TimeRange.From.UnixNano() / 1e6
-	to := model.TimeRange.To.UnixNano() / 1e6
+// has reports whether name is a built-in or a custom macro
+func (t *macroSet) has(name string) bool {
+	if _, ok := macroFuncs[name]; ok {
+		return true
+	}
+	_, ok := t.custom[name]
+	return ok
+}
 
-	replacement := fmt.Sprintf("time BETWEEN from_milliseconds(%d) AND from_milliseconds(%d)", from, to)
+// expand replaces the placeholders of the macro with the arguments
+func (m customMacro) expand(args []string) (string, error) {
+	if len(args) != m.params {
+		return "", fmt.Errorf("expects %d arguments, got %d", m.params, len(args))
+	}
+	return macroPlaceholder.ReplaceAllStringFunc(m.sql, func(placeholder string) string {
+		n, _ := strconv.Atoi(placeholder[1:])
+		return args[n-1]
+	}), nil
+}
+
+// withoutArgs adapts a macro that only reads the query
+func withoutArgs(fn func(models.QueryModel, models.DatasourceSettings) (string, error)) macroFunc {
+	return func(model *models.QueryModel, settings models.DatasourceSettings, args []string) (string, error) {
+		if len(args) > 0 {
+			return "", fmt.Errorf("expects no arguments, got %d", len(args))
+		}
+		return fn(*model, settings)
+	}
+}
+
+// macroTimeFilter filters a time column, optionally holding wall clock times of a
+// timezone, like $__timeFilter(local_time, 'Europe/Berlin')
+func macroTimeFilter(model *models.QueryModel, _ models.DatasourceSettings, args []string) (string, error) {
+	column := "time"
+	var loc *time.Location
+	switch len(args) {
+	case 0:
+	case 1, 2:
+		if args[0] == "" {
+			return "", fmt.Errorf("the time column is missing")
+		}
+		column = args[0]
+		if len(args) == 2 {
+			var err error
+			if loc, err = loadLocation(args[1]); err != nil {
+				return "", err
+			}
+		}
+	default:
+		return "", fmt.Errorf("expects an optional time column and timezone, got %d arguments", len(args))
+	}
+
+	from := wallClock(model.TimeRange.From, loc).UnixNano() / 1e6
+	to := wallClock(model.TimeRange.To, loc).UnixNano() / 1e6
+
+	replacement := fmt.Sprintf("%s BETWEEN from_milliseconds(%d) AND from_milliseconds(%d)", column, from, to)
 	return replacement, nil
 }
 
-func macroTimeFrom(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
-	return fmt.Sprintf("%d", model.TimeRange.From.UnixNano()/1e6), nil
+// macroTimeFilterShift filters on the time range moved back by a shift, like
+// $__timeFilterShift(time, 7d) for the same range a week ago
+func macroTimeFilterShift(model *models.QueryModel, settings models.DatasourceSettings, args []string) (string, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", fmt.Errorf("expects a time column, a shift and an optional timezone, got %d arguments", len(args))
+	}
+	shifted, err := shiftedModel(model, args[1])
+	if err != nil {
+		return "", err
+	}
+	return macroTimeFilter(shifted, settings, slices.Delete(slices.Clone(args), 1, 2))
 }
 
-func macroTimeTo(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
-	return fmt.Sprintf("%d", model.TimeRange.To.UnixNano()/1e6), nil
+func macroTimeFromShift(model *models.QueryModel, settings models.DatasourceSettings, args []string) (string, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", fmt.Errorf("expects a shift and an optional format, got %d arguments", len(args))
+	}
+	shifted, err := shiftedModel(model, args[0])
+	if err != nil {
+		return "", err
+	}
+	return macroTimeFrom(shifted, settings, args[1:])
+}
+
+func macroTimeToShift(model *models.QueryModel, settings models.DatasourceSettings, args []string) (string, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", fmt.Errorf("expects a shift and an optional format, got %d arguments", len(args))
+	}
+	shifted, err := shiftedModel(model, args[0])
+	if err != nil {
+		return "", err
+	}
+	return macroTimeTo(shifted, settings, args[1:])
+}
+
+// shiftedModel returns a copy of the model with the time range moved back by shift
+func shiftedModel(model *models.QueryModel, shift string) (*models.QueryModel, error) {
+	d, err := models.ParseDuration(shift)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shift: %q", shift)
+	}
+	shifted := *model
+	shifted.TimeRange = shiftTimeRange(model.TimeRange, d)
+	return &shifted, nil
+}
+
+func shiftTimeRange(tr backend.TimeRange, shift time.Duration) backend.TimeRange {
+	return backend.TimeRange{From: tr.From.Add(-shift), To: tr.To.Add(-shift)}
+}
+
+func macroTimeFrom(model *models.QueryModel, _ models.DatasourceSettings, args []string) (string, error) {
+	return formatTime(model.TimeRange.From, args)
+}
+
+func macroTimeTo(model *models.QueryModel, _ models.DatasourceSettings, args []string) (string, error) {
+	return formatTime(model.TimeRange.To, args)
+}
+
+// formatTime writes t in the format given by the optional argument:
+// ms (default), s, ns, or iso for a quoted ISO 8601 string
+func formatTime(t time.Time, args []string) (string, error) {
+	format := "ms"
+	switch len(args) {
+	case 0:
+	case 1:
+		format = strings.ToLower(args[0])
+	default:
+		return "", fmt.Errorf("expects an optional format, got %d arguments", len(args))
+	}
+	switch format {
+	case "ms":
+		return fmt.Sprintf("%d", t.UnixNano()/1e6), nil
+	case "s":
+		return fmt.Sprintf("%d", t.Unix()), nil
+	case "ns":
+		return fmt.Sprintf("%d", t.UnixNano()), nil
+	case "iso":
+		return fmt.Sprintf("'%s'", t.UTC().Format(time.RFC3339Nano)), nil
+	}
+	return "", fmt.Errorf("invalid format: %q, expecting ms, s, ns or iso", args[0])
+}
+
+// macroTimezone is the dashboard timezone, UTC when it is not known
+// macroTimezone is the dashboard timezone. It comes with the request, so it must be
+// a known timezone, and is escaped for string literals all the same.
+func macroTimezone(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	if model.Timezone == "" {
+		return "UTC", nil
+	}
+	if _, err := time.LoadLocation(model.Timezone); err != nil {
+		return "", fmt.Errorf("invalid timezone: %q", model.Timezone)
+	}
+	return strings.ReplaceAll(model.Timezone, "'", "''"), nil
+}
+
+// loadLocation reads a timezone name, quoted or not
+func loadLocation(arg string) (*time.Location, error) {
+	name := arg
+	if len(arg) >= 2 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+		name = strings.ReplaceAll(arg[1:len(arg)-1], "''", "'")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" {
+		return nil, fmt.Errorf("invalid timezone: %q", arg)
+	}
+	return loc, nil
+}
+
+// wallClock returns the time shown by a clock in loc, as if it was UTC. Timestream
+// has no timezones, so local times are stored that way.
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		return t
+	}
+	_, offset := t.In(loc).Zone()
+	return t.Add(time.Duration(offset) * time.Second)
 }
 
 func macroInterval(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
@@ -67,6 +280,24 @@ func macroIntervalRaw(model models.QueryModel, _ models.DatasourceSettings) (str
 	return fmt.Sprintf("%d", model.Interval.Milliseconds()), nil
 }
 
+// Scrape interval of $__rate_interval when the datasource has no minimum interval
+const defaultScrapeInterval = 15 * time.Second
+
+// macroRateInterval is the interval Grafana uses for rates, which is long enough to
+// hold several points: max($__interval + scrape interval, 4 * scrape interval).
+// The minimum interval of the datasource is the scrape interval.
+func macroRateInterval(model models.QueryModel, settings models.DatasourceSettings) (string, error) {
+	if model.Interval.Milliseconds() == 0 {
+		return "", fmt.Errorf("invalid interval: %dns", model.Interval.Nanoseconds())
+	}
+	scrape := time.Duration(settings.MinInterval)
+	if scrape <= 0 {
+		scrape = defaultScrapeInterval
+	}
+	interval := max(model.Interval+scrape, 4*scrape)
+	return fmt.Sprintf("%dms", interval.Milliseconds()), nil
+}
+
 func macroNow(_ models.QueryModel, _ models.DatasourceSettings) (string, error) {
 	now := time.Now().UnixMilli()
 	return fmt.Sprintf("%d", now), nil
@@ -82,26 +313,184 @@ func macroMeasure(model models.QueryModel, settings models.DatasourceSettings) (
 	return valueOrDefault(model.Measure, settings.DefaultMeasure), nil
 }
 
-func valueOrDefault(value string, defaultValue string) string {
-	if value == "" || strings.HasPrefix(value, "${") {
-		return defaultValue
+func macroTimeGroup(model *models.QueryModel, _ models.DatasourceSettings, args []string) (string, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return "", fmt.Errorf("expects a column, an interval and an optional fill mode, got %d arguments", len(args))
 	}
-	return value
+	if args[0] == "" {
+		return "", fmt.Errorf("the time column is missing")
+	}
+	interval, err := parseTimeGroupInterval(args[1], model.Interval)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 3 {
+		fill, err := parseFillMode(args[2])
+		if err != nil {
+			return "", err
+		}
+		fill.Interval = interval
+		model.FillMissing = fill
+	}
+	return fmt.Sprintf("bin(%s, %s)", args[0], formatInterval(interval)), nil
 }
 
-// Interpolate processes macros
-func Interpolate(model models.QueryModel, settings models.DatasourceSettings) (string, error) {
-	query := model.RawQuery
-	for _, key := range macroKeys {
-		macroKey := fmt.Sprintf("$__%s", key)
-		if !strings.Contains(query, macroKey) {
+// parseTimeGroupInterval reads durations like 5m or 1d, or the panel interval
+func parseTimeGroupInterval(arg string, panelInterval time.Duration) (time.Duration, error) {
+	var interval time.Duration
+	switch arg {
+	case "auto":
+		interval = panelInterval
+	default:
+		var err error
+		interval, err = models.ParseDuration(arg)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval: %q", arg)
+		}
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid interval: %q", arg)
+	}
+	return interval, nil
+}
+
+func parseFillMode(arg string) (*models.FillMissing, error) {
+	switch mode := models.FillMode(strings.ToLower(arg)); mode {
+	case models.FillModeNull, models.FillModePrevious, models.FillModeLinear:
+		return &models.FillMissing{Mode: mode}, nil
+	}
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fill mode: %q, expecting null, previous, linear or a number", arg)
+	}
+	return &models.FillMissing{Mode: models.FillModeValue, Value: value}, nil
+}
+
+// formatInterval writes a Timestream interval literal in the largest exact unit
+func formatInterval(d time.Duration) string {
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+		{"us", time.Microsecond},
+	}
+	for _, u := range units {
+		if d%u.size == 0 {
+			return fmt.Sprintf("%d%s", d/u.size, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dns", d.Nanoseconds())
+}
+
+// allValue is the custom "All" value that turns a filter off
+const allValue = "$__all"
+
+// macroDimensionFilter filters a dimension by name, quoting it as an identifier
+func macroDimensionFilter(_ *models.QueryModel, _ models.DatasourceSettings, args []string) (string, error) {
+	if len(args) == 0 || args[0] == "" {
+		return "", fmt.Errorf("the dimension name is missing")
+	}
+	return inFilter(applyQuotesIfNeeded(args[0]), args[1:]), nil
+}
+
+// macroIn filters any column expression
+func macroIn(_ *models.QueryModel, _ models.DatasourceSettings, args []string) (string, error) {
+	if len(args) == 0 || args[0] == "" {
+		return "", fmt.Errorf("the column is missing")
+	}
+	return inFilter(args[0], args[1:]), nil
+}
+
+// inFilter builds column IN ('a', 'b') from the values of a template variable.
+// Every value is written as a string literal, like the dimensions it filters: quoted
+// arguments, as sent by the frontend, are unescaped first, and unquoted ones are quoted.
+func inFilter(column string, args []string) string {
+	values := []string{}
+	for _, arg := range args {
+		if arg == "" {
 			continue
 		}
-		replacement, err := macroFuncs[key](model, settings)
+		value := arg
+		if len(arg) >= 2 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+			value = strings.ReplaceAll(arg[1:len(arg)-1], "''", "'")
+		}
+		if value == allValue {
+			return "TRUE"
+		}
+		values = append(values, quoteString(value))
+	}
+	if len(values) == 0 {
+		// Nothing selected matches nothing
+		return "FALSE"
+	}
+	return fmt.Sprintf("%s IN (%s)", column, strings.Join(values, ", "))
+}
+
+// macroAdhocFilters renders the ad hoc filters as predicates to append to a WHERE
+// clause, each starting with AND. It is empty when there are no filters.
+func macroAdhocFilters(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	var sb strings.Builder
+	for _, filter := range model.AdhocFilters {
+		predicate, err := adhocPredicate(filter)
 		if err != nil {
-			return query, backend.DownstreamError(err)
+			return "", err
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString("AND ")
+		sb.WriteString(predicate)
+	}
+	return sb.String(), nil
+}
+
+func adhocPredicate(filter models.AdhocFilter) (string, error) {
+	if filter.Key == "" {
+		return "", fmt.Errorf("ad hoc filter without a key")
+	}
+	key := quoteIdentifier(filter.Key)
+	switch filter.Operator {
+	case "=", "!=", "<", ">", "<=", ">=":
+		return fmt.Sprintf("%s %s %s", key, filter.Operator, quoteString(filter.Value)), nil
+	case "=~":
+		return fmt.Sprintf("regexp_like(%s, %s)", key, quoteString(filter.Value)), nil
+	case "!~":
+		return fmt.Sprintf("NOT regexp_like(%s, %s)", key, quoteString(filter.Value)), nil
+	case "=|", "!=|":
+		values := make([]string, len(filter.Values))
+		for i, v := range filter.Values {
+			values[i] = quoteString(v)
+		}
+		if len(values) == 0 {
+			values = append(values, quoteString(filter.Value))
+		}
+		op := "IN"
+		if filter.Operator == "!=|" {
+			op = "NOT IN"
 		}
-		query = strings.ReplaceAll(query, macroKey, replacement)
+		return fmt.Sprintf("%s %s (%s)", key, op, strings.Join(values, ", ")), nil
 	}
-	return query, nil
+	return "", fmt.Errorf("unsupported ad hoc filter operator %q for %s", filter.Operator, filter.Key)
+}
+
+// quoteIdentifier quotes a column name, escaping the quotes it holds
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteString quotes a string literal, escaping the quotes it holds
+func quoteString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func valueOrDefault(value string, defaultValue string) string {
+	if value == "" || strings.HasPrefix(value, "${") {
+		return defaultValue
+	}
+	return value
 }
@@ -151,3 +151,370 @@ func TestInterpolate(t *testing.T) {
 		}
 	})
 }
+
+func TestInterpolateTimeGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    string
+		expect string
+		fill   *models.FillMissing
+	}{
+		{"duration", `SELECT $__timeGroup(time, 5m) AS t`, `SELECT bin(time, 5m) AS t`, nil},
+		{"days", `$__timeGroup(time, 1d)`, `bin(time, 1d)`, nil},
+		{"panel interval", `$__timeGroup(time, $__interval)`, `bin(time, 30s)`, nil},
+		{"mixed units", `$__timeGroup(time, 90s)`, `bin(time, 90s)`, nil},
+		{"expression column", `$__timeGroup(date_add('hour', 1, time), 1h)`, `bin(date_add('hour', 1, time), 1h)`, nil},
+		{"several", `$__timeGroup(time, 1m) ... $__timeGroup(time,1m)`, `bin(time, 1m) ... bin(time, 1m)`, nil},
+		{"null fill", `$__timeGroup(time, 1m, NULL)`, `bin(time, 1m)`, &models.FillMissing{Mode: models.FillModeNull, Interval: time.Minute}},
+		{"previous fill", `$__timeGroup(time, 1m, previous)`, `bin(time, 1m)`, &models.FillMissing{Mode: models.FillModePrevious, Interval: time.Minute}},
+		{"linear fill", `$__timeGroup(time, 1m, linear)`, `bin(time, 1m)`, &models.FillMissing{Mode: models.FillModeLinear, Interval: time.Minute}},
+		{"value fill", `$__timeGroup(time, 1m, 0.5)`, `bin(time, 1m)`, &models.FillMissing{Mode: models.FillModeValue, Value: 0.5, Interval: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, Interval: 30 * time.Second}
+			text, fill, err := builtinMacros.interpolate(query, models.DatasourceSettings{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(tt.expect, text); diff != "" {
+				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.fill, fill); diff != "" {
+				t.Fatalf("Fill mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, sql := range []string{
+		`$__timeGroup`,
+		`$__timeGroup(time)`,
+		`$__timeGroup(time, 5m`,
+		`$__timeGroup(time, soon)`,
+		`$__timeGroup(time, -5m)`,
+		`$__timeGroup(time, 5m, sideways)`,
+		`$__timeGroup(, 5m)`,
+	} {
+		t.Run("invalid "+sql, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: sql}
+			if _, err := Interpolate(query, models.DatasourceSettings{}); err == nil {
+				t.Fatal("should error")
+			}
+		})
+	}
+}
+
+func TestInterpolateDimensionFilter(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.UnixMilli(1500376552001),
+		To:   time.UnixMilli(1500376552002),
+	}
+
+	tests := []struct {
+		name   string
+		sql    string
+		expect string
+	}{
+		{"multiple values", `$__in(region, 'us-east-1','eu-west-1')`, `region IN ('us-east-1', 'eu-west-1')`},
+		{"single value", `$__in(region, us-east-1)`, `region IN ('us-east-1')`},
+		{"escaped values", `$__in(host, 'it''s','a,b')`, `host IN ('it''s', 'a,b')`},
+		{"column expression", `$__in(lower(host), 'a')`, `lower(host) IN ('a')`},
+		{"all", `$__in(region, $__all)`, `TRUE`},
+		{"quoted all", `$__in(region, '$__all')`, `TRUE`},
+		{"wildcard value", `$__in(region, '*')`, `region IN ('*')`},
+		{"nothing selected", `$__in(region, )`, `FALSE`},
+		{"dimension name", `$__dimensionFilter(az, 'a', 'b')`, `"az" IN ('a', 'b')`},
+		{"quoted dimension name", `$__dimensionFilter("cell-name", 'a')`, `"cell-name" IN ('a')`},
+		{
+			"with time filter",
+			`WHERE $__timeFilter AND $__dimensionFilter(region, 'a') AND $__in(az, $__all)`,
+			`WHERE time BETWEEN from_milliseconds(1500376552001) AND from_milliseconds(1500376552002) AND "region" IN ('a') AND TRUE`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, TimeRange: timeRange}
+			text, err := Interpolate(query, models.DatasourceSettings{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(tt.expect, text); diff != "" {
+				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, sql := range []string{`$__in`, `$__in()`, `$__dimensionFilter(, 'a')`} {
+		t.Run("invalid "+sql, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: sql}
+			if _, err := Interpolate(query, models.DatasourceSettings{}); err == nil {
+				t.Fatal("should error")
+			}
+		})
+	}
+}
+
+func TestInterpolateAdhocFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []models.AdhocFilter
+		expect  string
+	}{
+		{"no filters", nil, `WHERE measure_name = 'cpu' `},
+		{
+			"equality",
+			[]models.AdhocFilter{{Key: "region", Operator: "=", Value: "us-east-1"}, {Key: "az", Operator: "!=", Value: "b"}},
+			`WHERE measure_name = 'cpu' AND "region" = 'us-east-1' AND "az" != 'b'`,
+		},
+		{
+			"escaped",
+			[]models.AdhocFilter{{Key: `cell"name`, Operator: "=", Value: "it's"}},
+			`WHERE measure_name = 'cpu' AND "cell""name" = 'it''s'`,
+		},
+		{
+			"regex",
+			[]models.AdhocFilter{{Key: "host", Operator: "=~", Value: "^web"}, {Key: "host", Operator: "!~", Value: "-1$"}},
+			`WHERE measure_name = 'cpu' AND regexp_like("host", '^web') AND NOT regexp_like("host", '-1$')`,
+		},
+		{
+			"one of",
+			[]models.AdhocFilter{{Key: "az", Operator: "=|", Values: []string{"a", "b"}}, {Key: "region", Operator: "!=|", Value: "x"}},
+			`WHERE measure_name = 'cpu' AND "az" IN ('a', 'b') AND "region" NOT IN ('x')`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: `WHERE measure_name = 'cpu' $__adhocFilters`, AdhocFilters: tt.filters}
+			text, err := Interpolate(query, models.DatasourceSettings{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(tt.expect, text); diff != "" {
+				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, filter := range []models.AdhocFilter{{Key: "az", Operator: "<>", Value: "a"}, {Operator: "=", Value: "a"}} {
+		t.Run("invalid "+filter.Operator, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: `$__adhocFilters`, AdhocFilters: []models.AdhocFilter{filter}}
+			if _, err := Interpolate(query, models.DatasourceSettings{}); err == nil {
+				t.Fatal("should error")
+			}
+		})
+	}
+}
+
+func TestInterpolateTimeShift(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.UnixMilli(1500376552001),
+		To:   time.UnixMilli(1500376552002),
+	}
+	week := int64(7 * 24 * time.Hour / time.Millisecond)
+
+	tests := []struct {
+		name   string
+		sql    string
+		expect string
+	}{
+		{
+			"filter",
+			`WHERE $__timeFilterShift(event_time, 7d)`,
+			fmt.Sprintf(`WHERE event_time BETWEEN from_milliseconds(%d) AND from_milliseconds(%d)`, 1500376552001-week, 1500376552002-week),
+		},
+		{"from", `$__timeFromShift(1w)`, fmt.Sprintf(`%d`, 1500376552001-week)},
+		{"to", `$__timeToShift(1h)`, fmt.Sprintf(`%d`, 1500376552002-3600000)},
+		{"forward", `$__timeFromShift(-1s)`, `1500376553001`},
+		{"unshifted macros are unchanged", `$__timeFrom $__timeFromShift(1s)`, `1500376552001 1500376551001`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, TimeRange: timeRange}
+			text, err := Interpolate(query, models.DatasourceSettings{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(tt.expect, text); diff != "" {
+				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, sql := range []string{`$__timeFilterShift(time)`, `$__timeFromShift`, `$__timeToShift(yesterday)`} {
+		t.Run("invalid "+sql, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: sql}
+			if _, err := Interpolate(query, models.DatasourceSettings{}); err == nil {
+				t.Fatal("should error")
+			}
+		})
+	}
+}
+
+func TestInterpolateTimeFormats(t *testing.T) {
+	// 2017-07-18T11:15:52.001Z, summer time (UTC+2) in Berlin
+	timeRange := backend.TimeRange{
+		From: time.UnixMilli(1500376552001),
+		To:   time.UnixMilli(1500376552002).Add(3),
+	}
+
+	tests := []struct {
+		name     string
+		sql      string
+		timezone string
+		expect   string
+	}{
+		{"milliseconds", `$__timeFrom(ms)`, "", `1500376552001`},
+		{"seconds", `$__timeFrom(s) $__timeTo(s)`, "", `1500376552 1500376552`},
+		{"nanoseconds", `$__timeTo(ns)`, "", `1500376552002000003`},
+		{"iso", `from_iso8601_timestamp($__timeFrom(iso))`, "", `from_iso8601_timestamp('2017-07-18T11:15:52.001Z')`},
+		{"shifted iso", `$__timeToShift(1h, iso)`, "", `'2017-07-18T10:15:52.002000003Z'`},
+		{
+			"filter in a timezone",
+			`$__timeFilter(local_time, 'Europe/Berlin')`, "",
+			`local_time BETWEEN from_milliseconds(1500383752001) AND from_milliseconds(1500383752002)`,
+		},
+		{
+			"filter in the dashboard timezone",
+			`$__timeFilter(local_time, $__timezone)`, "Europe/Berlin",
+			`local_time BETWEEN from_milliseconds(1500383752001) AND from_milliseconds(1500383752002)`,
+		},
+		{
+			"shifted filter in a timezone",
+			`$__timeFilterShift(local_time, 1d, 'America/New_York')`, "",
+			`local_time BETWEEN from_milliseconds(1500275752001) AND from_milliseconds(1500275752002)`,
+		},
+		{"timezone", `'$__timezone'`, "Europe/Berlin", `'Europe/Berlin'`},
+		{"default timezone", `'$__timezone'`, "", `'UTC'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, TimeRange: timeRange, Timezone: tt.timezone}
+			text, err := Interpolate(query, models.DatasourceSettings{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(tt.expect, text); diff != "" {
+				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, sql := range []string{`$__timeFrom(days)`, `$__timeTo(s, ms)`, `$__timeFilter(time, 'Mars/Olympus')`, `$__timeFilter(time, '')`} {
+		t.Run("invalid "+sql, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: sql}
+			if _, err := Interpolate(query, models.DatasourceSettings{}); err == nil {
+				t.Fatal("should error")
+			}
+		})
+	}
+
+	// The dashboard timezone comes from the request
+	for _, timezone := range []string{"Mars/Olympus", "UTC' OR '1'='1", "../UTC"} {
+		for _, sql := range []string{`'$__timezone'`, `$__timeFilter(local_time, $__timezone)`} {
+			t.Run("invalid timezone "+timezone+" in "+sql, func(t *testing.T) {
+				query := models.QueryModel{RawQuery: sql, TimeRange: timeRange, Timezone: timezone}
+				_, err := Interpolate(query, models.DatasourceSettings{})
+				if err == nil {
+					t.Fatal("should error")
+				}
+				if !backend.IsDownstreamError(err) {
+					t.Fatalf("should be a downstream error: %s", err)
+				}
+			})
+		}
+	}
+}
+
+func TestInterpolateMinInterval(t *testing.T) {
+	query := models.QueryModel{
+		RawQuery: `bin(time, $__interval) $__interval_raw_ms $__timeGroup(time, auto)`,
+		Interval: 500 * time.Microsecond,
+	}
+	text, err := Interpolate(query, models.DatasourceSettings{MinInterval: models.Duration(time.Minute)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(`bin(time, 60000ms) 60000 bin(time, 1m)`, text); diff != "" {
+		t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+	}
+	if query.Interval != 500*time.Microsecond {
+		t.Fatalf("the query interval was changed to %s", query.Interval)
+	}
+}
+
+func TestInterpolateMinIntervalWithoutInterval(t *testing.T) {
+	query := models.QueryModel{RawQuery: `bin(time, $__interval)`}
+	text, err := Interpolate(query, models.DatasourceSettings{MinInterval: models.Duration(time.Minute)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(`bin(time, 60000ms)`, text); diff != "" {
+		t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestInterpolateCustomMacros(t *testing.T) {
+	settings := models.DatasourceSettings{
+		DefaultDatabase: "db",
+		Macros: map[string]string{
+			"tenantFilter":     "account_id = '$1' AND $__timeFilter",
+			"celsius":          "($1 - 32) * 5 / 9",
+			"celsiusRounded":   "round($__celsius($1), $2)",
+			"tenantFilterDays": "$__tenantFilter($1) AND days = $10",
+			"loop":             "$__loop",
+		},
+	}
+	timeRange := backend.TimeRange{
+		From: time.UnixMilli(1500376552001),
+		To:   time.UnixMilli(1500376552002),
+	}
+
+	tests := []struct {
+		name   string
+		sql    string
+		expect string
+	}{
+		{
+			"placeholders and built-in macros",
+			`WHERE $__tenantFilter(acme)`,
+			`WHERE account_id = 'acme' AND time BETWEEN from_milliseconds(1500376552001) AND from_milliseconds(1500376552002)`,
+		},
+		{"nested custom macros", `SELECT $__celsiusRounded(measure_value::double, 1)`, `SELECT round((measure_value::double - 32) * 5 / 9, 1)`},
+		{"longest name wins", `$__celsius(f)`, `(f - 32) * 5 / 9`},
+		{"built-in macros in arguments", `$__celsius($__database)`, `(db - 32) * 5 / 9`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, TimeRange: timeRange}
+			text, err := Interpolate(query, settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(tt.expect, text); diff != "" {
+				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, sql := range []string{`$__celsius`, `$__celsius(a, b)`, `$__tenantFilterDays(acme)`, `$__loop`} {
+		t.Run("invalid "+sql, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: sql}
+			if _, err := Interpolate(query, settings); err == nil {
+				t.Fatal("should error")
+			}
+		})
+	}
+}
+
+func TestNewMacroSet(t *testing.T) {
+	for _, definitions := range []map[string]string{
+		{"timeFilter": "x"},
+		{"": "x"},
+		{"my-macro": "x"},
+		{"zero": "$0"},
+	} {
+		if _, err := newMacroSet(definitions); err == nil {
+			t.Fatalf("should error: %v", definitions)
+		}
+	}
+}
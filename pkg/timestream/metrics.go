@@ -0,0 +1,123 @@
+package timestream
+
+import (
+	"errors"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	metricsNamespace = "grafana_plugin"
+	metricsSubsystem = "timestream"
+)
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "query_duration_seconds",
+		Help:      "Duration of Timestream queries, including every page read for the response.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"datasource_uid"})
+
+	queriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "queries_total",
+		Help:      "Timestream queries executed, by error source and AWS error code.",
+	}, []string{"datasource_uid", "error_source", "error_code"})
+
+	bytesScannedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "bytes_scanned_total",
+		Help:      "Bytes scanned by Timestream queries.",
+	}, []string{"datasource_uid"})
+
+	pagesFetchedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "pages_fetched_total",
+		Help:      "Result pages fetched from Timestream.",
+	}, []string{"datasource_uid"})
+
+	resourceCallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "resource_calls_total",
+		Help:      "Resource calls handled, by path.",
+	}, []string{"datasource_uid", "path"})
+
+	cancellationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "cancellations_total",
+		Help:      "Timestream queries cancelled, by reason (user, request or timeout).",
+	}, []string{"datasource_uid", "reason"})
+)
+
+const (
+	cancelReasonUser    = "user"
+	cancelReasonRequest = "request"
+	cancelReasonTimeout = "timeout"
+)
+
+// knownResourcePaths keeps the path label bounded
+var knownResourcePaths = map[string]bool{
+	"hello":      true,
+	"cancel":     true,
+	"databases":  true,
+	"tables":     true,
+	"measures":   true,
+	"dimensions": true,
+	"tag-keys":   true,
+	"tag-values": true,
+}
+
+func (ds *timestreamDS) uid() string {
+	return ds.Settings.Config.UID
+}
+
+func (ds *timestreamDS) recordQuery(res *queryResult, seconds float64, err error) {
+	uid := ds.uid()
+	queryDuration.WithLabelValues(uid).Observe(seconds)
+	queriesTotal.WithLabelValues(uid, errorSource(err), errorCode(err)).Inc()
+	if res != nil {
+		bytesScannedTotal.WithLabelValues(uid).Add(float64(res.bytesScanned))
+		pagesFetchedTotal.WithLabelValues(uid).Add(float64(res.pages))
+	}
+}
+
+func (ds *timestreamDS) recordResourceCall(path string) {
+	if !knownResourcePaths[path] {
+		path = "unknown"
+	}
+	resourceCallsTotal.WithLabelValues(ds.uid(), path).Inc()
+}
+
+func (ds *timestreamDS) recordCancellation(reason string) {
+	cancellationsTotal.WithLabelValues(ds.uid(), reason).Inc()
+}
+
+func errorSource(err error) string {
+	switch {
+	case err == nil:
+		return "none"
+	case backend.IsPluginError(err):
+		return string(backend.ErrorSourcePlugin)
+	default:
+		// Errors from the Timestream client are downstream errors
+		return string(backend.ErrorSourceDownstream)
+	}
+}
+
+// errorCode returns the AWS error code, such as ThrottlingException
+func errorCode(err error) string {
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
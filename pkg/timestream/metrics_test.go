@@ -0,0 +1,55 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorLabels(t *testing.T) {
+	throttled := &timestreamquerytypes.ThrottlingException{Message: aws.String("slow down")}
+
+	tests := []struct {
+		name   string
+		err    error
+		source string
+		code   string
+	}{
+		{"no error", nil, "none", ""},
+		{"aws error", throttled, "downstream", "ThrottlingException"},
+		{"wrapped aws error", backend.DownstreamError(fmt.Errorf("query: %w", throttled)), "downstream", "ThrottlingException"},
+		{"plugin error", backend.PluginError(fmt.Errorf("broken")), "plugin", ""},
+		{"cancelled", context.Canceled, "downstream", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.source, errorSource(tt.err))
+			assert.Equal(t, tt.code, errorCode(tt.err))
+		})
+	}
+}
+
+func TestResourceQueryMetrics(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		QueryStatus: &timestreamquerytypes.QueryStatus{CumulativeBytesScanned: 100},
+	}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{DefaultDatabase: "db", DefaultTable: "tbl"}}
+	ds.Settings.Config.UID = "resource-metrics"
+
+	for _, path := range []string{"databases", "tag-keys"} {
+		err := ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: path, Method: "POST", Body: []byte(`{}`)}, backend.CallResourceResponseSenderFunc(func(*backend.CallResourceResponse) error { return nil }))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2.0, testutil.ToFloat64(queriesTotal.WithLabelValues("resource-metrics", "none", "")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(pagesFetchedTotal.WithLabelValues("resource-metrics")))
+	assert.Equal(t, 200.0, testutil.ToFloat64(bytesScannedTotal.WithLabelValues("resource-metrics")))
+}
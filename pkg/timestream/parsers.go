@@ -2,11 +2,14 @@ package timestream
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
 )
 
 type datumParser func(datum timestreamquerytypes.Datum) (interface{}, error)
@@ -19,9 +22,24 @@ type fieldBuilder struct {
 	parser     datumParser
 	asJSON     bool // if true, the results will be marshaled to json first
 	timeseries bool
+
+	// Indexes of the value inside nested ROW values, for flattened rows
+	path []int
+}
+
+// datum returns the value of the builder in a cell of its column
+func (b *fieldBuilder) datum(cell timestreamquerytypes.Datum) timestreamquerytypes.Datum {
+	for _, idx := range b.path {
+		if cell.RowValue == nil || idx >= len(cell.RowValue.Data) {
+			// A null row has null fields
+			return timestreamquerytypes.Datum{}
+		}
+		cell = cell.RowValue.Data[idx]
+	}
+	return cell
 }
 
-func getFieldBuilder(t *timestreamquerytypes.Type) (*fieldBuilder, error) {
+func getFieldBuilder(t *timestreamquerytypes.Type, opts models.ResultOptions) (*fieldBuilder, error) {
 	if t.ScalarType != "" {
 		switch t.ScalarType {
 		case timestreamquerytypes.ScalarTypeTimestamp:
@@ -57,15 +75,29 @@ func getFieldBuilder(t *timestreamquerytypes.Type) (*fieldBuilder, error) {
 			}, nil
 
 		case timestreamquerytypes.ScalarTypeIntervalDayToSecond:
+			if opts.IntervalsAsStrings {
+				return &fieldBuilder{
+					fieldType: data.FieldTypeNullableString,
+					parser:    datumParserInterval,
+				}, nil
+			}
 			return &fieldBuilder{
-				fieldType: data.FieldTypeNullableString,
-				parser:    datumParserInterval,
+				fieldType: data.FieldTypeNullableFloat64,
+				parser:    datumParserDayToSecond,
+				config:    &data.FieldConfig{Unit: "ms"},
 			}, nil
 
 		case timestreamquerytypes.ScalarTypeIntervalYearToMonth:
+			if opts.IntervalsAsStrings {
+				return &fieldBuilder{
+					fieldType: data.FieldTypeNullableString,
+					parser:    datumParserInterval,
+				}, nil
+			}
 			return &fieldBuilder{
-				fieldType: data.FieldTypeNullableString,
-				parser:    datumParserInterval,
+				fieldType: data.FieldTypeNullableInt64,
+				parser:    datumParserYearToMonth,
+				config:    &data.FieldConfig{Unit: "months"},
 			}, nil
 
 		case timestreamquerytypes.ScalarTypeDate:
@@ -86,7 +118,7 @@ func getFieldBuilder(t *timestreamquerytypes.Type) (*fieldBuilder, error) {
 	}
 
 	if t.TimeSeriesMeasureValueColumnInfo != nil {
-		builder, err := getFieldBuilder(t.TimeSeriesMeasureValueColumnInfo.Type)
+		builder, err := getFieldBuilder(t.TimeSeriesMeasureValueColumnInfo.Type, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -95,18 +127,18 @@ func getFieldBuilder(t *timestreamquerytypes.Type) (*fieldBuilder, error) {
 	}
 
 	if t.RowColumnInfo != nil {
-		return getRowBuilder(t.RowColumnInfo)
+		return getRowBuilder(t.RowColumnInfo, opts)
 	}
 
 	if t.ArrayColumnInfo != nil {
-		return getArrayBuilder(t.ArrayColumnInfo)
+		return getArrayBuilder(t.ArrayColumnInfo, opts)
 	}
 
 	return nil, fmt.Errorf("unsupported column: %+v", t)
 }
 
-func getArrayBuilder(column *timestreamquerytypes.ColumnInfo) (*fieldBuilder, error) {
-	elem, err := getFieldBuilder(column.Type)
+func getArrayBuilder(column *timestreamquerytypes.ColumnInfo, opts models.ResultOptions) (*fieldBuilder, error) {
+	elem, err := getFieldBuilder(column.Type, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -136,11 +168,42 @@ func getArrayBuilder(column *timestreamquerytypes.ColumnInfo) (*fieldBuilder, er
 	}, nil
 }
 
-func getRowBuilder(columns []timestreamquerytypes.ColumnInfo) (*fieldBuilder, error) {
+// getFlatRowBuilders returns a builder for each field of a ROW column, named
+// column.field, descending into nested rows
+func getFlatRowBuilders(name string, columns []timestreamquerytypes.ColumnInfo, path []int, opts models.ResultOptions) ([]*fieldBuilder, error) {
+	builders := []*fieldBuilder{}
+	for i, column := range columns {
+		fieldName := fmt.Sprintf("field%d", i)
+		if column.Name != nil {
+			fieldName = *column.Name
+		}
+		fieldName = name + "." + fieldName
+		fieldPath := append(slices.Clone(path), i)
+
+		if column.Type.RowColumnInfo != nil {
+			nested, err := getFlatRowBuilders(fieldName, column.Type.RowColumnInfo, fieldPath, opts)
+			if err != nil {
+				return nil, err
+			}
+			builders = append(builders, nested...)
+			continue
+		}
+		b, err := getFieldBuilder(column.Type, opts)
+		if err != nil {
+			return nil, err
+		}
+		b.name = fieldName
+		b.path = fieldPath
+		builders = append(builders, b)
+	}
+	return builders, nil
+}
+
+func getRowBuilder(columns []timestreamquerytypes.ColumnInfo, opts models.ResultOptions) (*fieldBuilder, error) {
 	count := len(columns)
 	cols := make([]*fieldBuilder, count)
 	for i := 0; i < len(columns); i++ {
-		elem, err := getFieldBuilder(columns[i].Type)
+		elem, err := getFieldBuilder(columns[i].Type, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -212,8 +275,11 @@ func datumParserTimestamp(datum timestreamquerytypes.Datum) (interface{}, error)
 	if datum.ScalarValue == nil {
 		return nil, nil
 	}
-	v, err := time.Parse("2006-01-02 15:04:05.99999999", *datum.ScalarValue)
-	return &v, err
+	v, err := parseTimestamp(*datum.ScalarValue)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
 }
 
 func datumParserDate(datum timestreamquerytypes.Datum) (interface{}, error) {
@@ -228,7 +294,7 @@ func datumParserTime(datum timestreamquerytypes.Datum) (interface{}, error) {
 	if datum.ScalarValue == nil {
 		return nil, nil
 	}
-	v, err := time.Parse("15:04:05.99999999", *datum.ScalarValue)
+	v, err := parseNanoTime(timeLayout, *datum.ScalarValue)
 	if err != nil {
 		return nil, err
 	}
@@ -237,15 +303,113 @@ func datumParserTime(datum timestreamquerytypes.Datum) (interface{}, error) {
 	return &properTime, nil
 }
 
+// Timestream writes times with up to nine fractional digits after these
+const (
+	timestampLayout = "2006-01-02 15:04:05"
+	timeLayout      = "15:04:05"
+)
+
+// parseTimestamp reads a TIMESTAMP value, like 2021-03-14 09:52:44.123456789
+func parseTimestamp(value string) (time.Time, error) {
+	return parseNanoTime(timestampLayout, value)
+}
+
+// parseNanoTime reads the fractional seconds itself, so each of the nine digits
+// Timestream may send is kept and any other input is an error
+func parseNanoTime(layout, value string) (time.Time, error) {
+	whole, frac, hasFrac := strings.Cut(value, ".")
+	t, err := time.Parse(layout, whole)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !hasFrac {
+		return t, nil
+	}
+	if frac == "" || len(frac) > 9 {
+		return time.Time{}, fmt.Errorf("invalid fractional seconds in %q", value)
+	}
+	nanos := 0
+	for i := 0; i < 9; i++ {
+		nanos *= 10
+		if i >= len(frac) {
+			continue
+		}
+		if frac[i] < '0' || frac[i] > '9' {
+			return time.Time{}, fmt.Errorf("invalid fractional seconds in %q", value)
+		}
+		nanos += int(frac[i] - '0')
+	}
+	return t.Add(time.Duration(nanos)), nil
+}
+
 func datumParserString(datum timestreamquerytypes.Datum) (interface{}, error) {
 	return datum.ScalarValue, nil
 }
 
+// datumParserInterval keeps the interval as written by the Timestream console
 func datumParserInterval(datum timestreamquerytypes.Datum) (interface{}, error) {
 	if datum.ScalarValue == nil {
 		return nil, nil
 	}
-	// TODO: parse into a better datatype, maybe an integer for millisecond?
-	// Right now this string is consistent with Timestream console
 	return datum.ScalarValue, nil
 }
+
+// datumParserDayToSecond reads an INTERVAL DAY TO SECOND, like -1 02:03:04.500000000,
+// in milliseconds
+func datumParserDayToSecond(datum timestreamquerytypes.Datum) (interface{}, error) {
+	if datum.ScalarValue == nil {
+		return nil, nil
+	}
+	value, negative := cutSign(*datum.ScalarValue)
+	days, clock, ok := strings.Cut(value, " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid interval: %q", *datum.ScalarValue)
+	}
+	d, err := strconv.ParseInt(days, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval: %q", *datum.ScalarValue)
+	}
+	t, err := parseNanoTime(timeLayout, clock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval: %q", *datum.ScalarValue)
+	}
+	sinceMidnight := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	ms := float64(d)*24*60*60*1000 + float64(sinceMidnight)/float64(time.Millisecond)
+	if negative {
+		ms = -ms
+	}
+	return &ms, nil
+}
+
+// datumParserYearToMonth reads an INTERVAL YEAR TO MONTH, like 1-6, in months
+func datumParserYearToMonth(datum timestreamquerytypes.Datum) (interface{}, error) {
+	if datum.ScalarValue == nil {
+		return nil, nil
+	}
+	value, negative := cutSign(*datum.ScalarValue)
+	years, months, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid interval: %q", *datum.ScalarValue)
+	}
+	y, err := strconv.ParseInt(years, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval: %q", *datum.ScalarValue)
+	}
+	m, err := strconv.ParseInt(months, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval: %q", *datum.ScalarValue)
+	}
+	total := y*12 + m
+	if negative {
+		total = -total
+	}
+	return &total, nil
+}
+
+// cutSign removes a leading sign from an interval
+func cutSign(value string) (string, bool) {
+	if rest, ok := strings.CutPrefix(value, "-"); ok {
+		return rest, true
+	}
+	return strings.TrimPrefix(value, "+"), false
+}
@@ -0,0 +1,64 @@
+package timestream
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Backoff before retry n is a random duration up to min(retryMaxDelay, retryBaseDelay * 2^n)
+var (
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// Throttling, timeouts, connection errors and 5xx responses are worth another attempt
+var retryables = retry.IsErrorRetryables(append([]retry.IsErrorRetryable{
+	retry.RetryableErrorCode{Codes: map[string]struct{}{
+		"InternalServerException": {},
+	}},
+}, retry.DefaultRetryables...))
+
+func isRetryable(err error) bool {
+	return retryables.IsErrorRetryable(err) == aws.TrueTernary
+}
+
+func retryDelay(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 32 {
+		delay = min(retryMaxDelay, retryBaseDelay<<attempt)
+	}
+	return time.Duration(rand.Int64N(int64(delay) + 1))
+}
+
+// queryWithRetry runs a query and retries retryable errors with jittered
+// exponential backoff. It also returns the number of retries it took.
+func (ds *timestreamDS) queryWithRetry(ctx context.Context, input *timestreamquery.QueryInput) (*timestreamquery.QueryOutput, int, error) {
+	retries := 0
+	for {
+		// The SDK retryer is disabled so the attempts are counted and configured here
+		output, err := ds.Client.Query(ctx, input, func(o *timestreamquery.Options) {
+			o.RetryMaxAttempts = 1
+		})
+		if err == nil || retries >= ds.Settings.MaxRetries || !isRetryable(err) {
+			return output, retries, err
+		}
+
+		delay := retryDelay(retries)
+		retries++
+		backend.Logger.Debug("retrying timestream query", "attempt", retries, "delay", delay, "error", err.Error())
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, retries, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyClient fails with the given errors before returning the output
+type flakyClient struct {
+	errs   []error
+	output *timestreamquery.QueryOutput
+	calls  int
+}
+
+func (c *flakyClient) Query(context.Context, *timestreamquery.QueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return nil, err
+	}
+	return c.output, nil
+}
+
+func (c *flakyClient) CancelQuery(context.Context, *timestreamquery.CancelQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	return nil, nil
+}
+
+func TestQueryWithRetry(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	throttled := &timestreamquerytypes.ThrottlingException{Message: aws.String("slow down")}
+	internal := &timestreamquerytypes.InternalServerException{Message: aws.String("oops")}
+	invalid := &timestreamquerytypes.ValidationException{Message: aws.String("bad sql")}
+
+	t.Run("retries throttling and server errors", func(t *testing.T) {
+		client := &flakyClient{errs: []error{throttled, internal}, output: &timestreamquery.QueryOutput{}}
+		ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{MaxRetries: 3}}
+
+		dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "SELECT 1"})
+		require.NoError(t, dr.Error)
+		assert.Equal(t, 3, client.calls)
+		assert.Equal(t, 2, dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).Retries)
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		client := &flakyClient{errs: []error{throttled, throttled, throttled}, output: &timestreamquery.QueryOutput{}}
+		ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{MaxRetries: 2}}
+
+		dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "SELECT 1"})
+		assert.ErrorIs(t, dr.Error, throttled)
+		assert.True(t, backend.IsDownstreamError(dr.Error))
+		assert.Equal(t, 3, client.calls)
+		assert.Equal(t, 2, dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).Retries)
+	})
+
+	t.Run("does not retry invalid queries", func(t *testing.T) {
+		client := &flakyClient{errs: []error{invalid}, output: &timestreamquery.QueryOutput{}}
+		ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{MaxRetries: 3}}
+
+		dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "SELECT 1"})
+		assert.ErrorIs(t, dr.Error, invalid)
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("stops waiting when the request is cancelled", func(t *testing.T) {
+		client := &flakyClient{errs: []error{throttled}, output: &timestreamquery.QueryOutput{}}
+		ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{MaxRetries: 3}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, retries, err := ds.queryWithRetry(ctx, &timestreamquery.QueryInput{})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, retries)
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("schema lookups are retried", func(t *testing.T) {
+		client := &flakyClient{errs: []error{throttled}, output: &timestreamquery.QueryOutput{
+			Rows: []timestreamquerytypes.Row{
+				{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("db")}}},
+			},
+		}}
+		ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{MaxRetries: 1}}
+
+		sender := &fakeSender{}
+		require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "databases"}, sender))
+		assert.Equal(t, `["\"db\""]`, string(sender.res.Body))
+		assert.Equal(t, 2, client.calls)
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := range 40 {
+		d := retryDelay(attempt)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, retryMaxDelay)
+	}
+}
@@ -0,0 +1,173 @@
+package timestream
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// mergeSeriesWide aligns series frames, each holding a time field and a labeled value
+// field, on a shared time field. Series without a value at a time are null there.
+func mergeSeriesWide(series []*data.Frame) (*data.Frame, error) {
+	if err := checkSeriesMergeable(series); err != nil {
+		return nil, err
+	}
+	rows := map[int64]int{}
+	for _, frame := range series {
+		for i := 0; i < frame.Fields[0].Len(); i++ {
+			rows[frame.Fields[0].At(i).(time.Time).UnixNano()] = 0
+		}
+	}
+	times := make([]int64, 0, len(rows))
+	for t := range rows {
+		times = append(times, t)
+	}
+	slices.Sort(times)
+
+	timeField := data.NewFieldFromFieldType(data.FieldTypeTime, len(times))
+	timeField.Name = "time"
+	for i, t := range times {
+		rows[t] = i
+		timeField.Set(i, time.Unix(0, t).UTC())
+	}
+
+	fields := []*data.Field{timeField}
+	for _, frame := range series {
+		src := frame.Fields[1]
+		dst := data.NewFieldFromFieldType(src.Type().NullableType(), len(times))
+		dst.Name = src.Name
+		dst.Labels = src.Labels
+		dst.Config = src.Config
+		for i := 0; i < src.Len(); i++ {
+			if v, ok := src.ConcreteAt(i); ok {
+				dst.SetConcrete(rows[frame.Fields[0].At(i).(time.Time).UnixNano()], v)
+			}
+		}
+		fields = append(fields, dst)
+	}
+	return data.NewFrame("", fields...), nil
+}
+
+// mergeSeriesLong writes the points of series frames as rows of one frame, with a
+// string field for each label and a field for each value name. Points of a series
+// that share a time share a row.
+func mergeSeriesLong(series []*data.Frame, labels []string) (*data.Frame, error) {
+	if err := checkSeriesMergeable(series); err != nil {
+		return nil, err
+	}
+	type point struct {
+		time   int64
+		labels string
+		series int
+	}
+	valueNames := []string{}
+	points := []point{}
+	rows := map[string]int{}
+	for s, frame := range series {
+		if !slices.Contains(valueNames, frame.Fields[1].Name) {
+			valueNames = append(valueNames, frame.Fields[1].Name)
+		}
+		key := frame.Fields[1].Labels.String()
+		for i := 0; i < frame.Fields[0].Len(); i++ {
+			t := frame.Fields[0].At(i).(time.Time).UnixNano()
+			row := seriesRowKey(key, t)
+			if _, ok := rows[row]; !ok {
+				rows[row] = len(points)
+				points = append(points, point{time: t, labels: key, series: s})
+			}
+		}
+	}
+	order := make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		pa, pb := points[order[a]], points[order[b]]
+		if pa.time != pb.time {
+			return pa.time < pb.time
+		}
+		return pa.labels < pb.labels
+	})
+	// Row of each point once sorted
+	position := make([]int, len(points))
+	for row, p := range order {
+		position[p] = row
+	}
+
+	timeField := data.NewFieldFromFieldType(data.FieldTypeTime, len(points))
+	timeField.Name = "time"
+	labelFields := make([]*data.Field, len(labels))
+	for i, name := range labels {
+		labelFields[i] = data.NewFieldFromFieldType(data.FieldTypeNullableString, len(points))
+		labelFields[i].Name = name
+	}
+	for p, pt := range points {
+		row := position[p]
+		timeField.Set(row, time.Unix(0, pt.time).UTC())
+		for i, name := range labels {
+			if v, ok := series[pt.series].Fields[1].Labels[name]; ok {
+				labelFields[i].SetConcrete(row, v)
+			}
+		}
+	}
+
+	valueFields := make([]*data.Field, len(valueNames))
+	for _, frame := range series {
+		src := frame.Fields[1]
+		idx := slices.Index(valueNames, src.Name)
+		if valueFields[idx] == nil {
+			valueFields[idx] = data.NewFieldFromFieldType(src.Type().NullableType(), len(points))
+			valueFields[idx].Name = src.Name
+			valueFields[idx].Config = src.Config
+		}
+		key := src.Labels.String()
+		for i := 0; i < src.Len(); i++ {
+			v, ok := src.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			t := frame.Fields[0].At(i).(time.Time).UnixNano()
+			valueFields[idx].SetConcrete(position[rows[seriesRowKey(key, t)]], v)
+		}
+	}
+
+	fields := append([]*data.Field{timeField}, labelFields...)
+	return data.NewFrame("", append(fields, valueFields...)...), nil
+}
+
+// checkSeriesMergeable returns an error when merging the series would overwrite
+// points: two series with the same name and labels, or a series with several
+// points at one time
+func checkSeriesMergeable(series []*data.Frame) error {
+	names := map[string]bool{}
+	for _, frame := range series {
+		value := frame.Fields[1]
+		name := value.Name
+		if len(value.Labels) > 0 {
+			name += " {" + value.Labels.String() + "}"
+		}
+		if names[name] {
+			return fmt.Errorf("several series are named %s", name)
+		}
+		names[name] = true
+
+		times := make(map[int64]bool, frame.Fields[0].Len())
+		for i := 0; i < frame.Fields[0].Len(); i++ {
+			t := frame.Fields[0].At(i).(time.Time)
+			if times[t.UnixNano()] {
+				return fmt.Errorf("the series %s has several points at %s", name, t.UTC().Format(time.RFC3339Nano))
+			}
+			times[t.UnixNano()] = true
+		}
+	}
+	return nil
+}
+
+// seriesRowKey identifies the row of a series at a time in the long format
+func seriesRowKey(labels string, t int64) string {
+	return labels + "\x00" + strconv.FormatInt(t, 10)
+}
@@ -0,0 +1,130 @@
+package timestream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seriesOf(points ...string) timestreamquerytypes.Datum {
+	series := []timestreamquerytypes.TimeSeriesDataPoint{}
+	for i := 0; i < len(points); i += 2 {
+		series = append(series, timestreamquerytypes.TimeSeriesDataPoint{
+			Time:  aws.String(points[i]),
+			Value: &timestreamquerytypes.Datum{ScalarValue: aws.String(points[i+1])},
+		})
+	}
+	return timestreamquerytypes.Datum{TimeSeriesValue: series}
+}
+
+func seriesOutput() *timestreamquery.QueryOutput {
+	doubleSeries := &timestreamquerytypes.Type{TimeSeriesMeasureValueColumnInfo: &timestreamquerytypes.ColumnInfo{
+		Type: &timestreamquerytypes.Type{ScalarType: "DOUBLE"},
+	}}
+	return &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("host"), Type: &timestreamquerytypes.Type{ScalarType: "VARCHAR"}},
+			{Name: aws.String("cpu"), Type: doubleSeries},
+			{Name: aws.String("mem"), Type: doubleSeries},
+		},
+		Rows: []timestreamquerytypes.Row{
+			{Data: []timestreamquerytypes.Datum{
+				{ScalarValue: aws.String("a")},
+				seriesOf("2021-03-14 09:00:00", "1", "2021-03-14 09:01:00", "2"),
+				seriesOf("2021-03-14 09:01:00", "50"),
+			}},
+			{Data: []timestreamquerytypes.Datum{
+				{ScalarValue: aws.String("b")},
+				seriesOf("2021-03-14 09:01:00", "3", "2021-03-14 09:02:00", "4"),
+				seriesOf(),
+			}},
+		},
+	}
+}
+
+func TestQueryResultToDataFrame_SeriesFormats(t *testing.T) {
+	minute := func(m int) time.Time { return time.Date(2021, 3, 14, 9, m, 0, 0, time.UTC) }
+
+	t.Run("a frame per series", func(t *testing.T) {
+		res := QueryResultToDataFrame(seriesOutput(), models.FormatOptionTimeSeries, models.ResultOptions{})
+		require.NoError(t, res.Error)
+		assert.Len(t, res.Frames, 4)
+	})
+
+	t.Run("wide", func(t *testing.T) {
+		res := QueryResultToDataFrame(seriesOutput(), models.FormatOptionTimeSeriesWide, models.ResultOptions{})
+		require.NoError(t, res.Error)
+		require.Len(t, res.Frames, 1)
+		frame := res.Frames[0]
+		require.Len(t, frame.Fields, 5)
+		assert.Equal(t, []time.Time{minute(0), minute(1), minute(2)}, valuesOf[time.Time](frame.Fields[0]))
+
+		assert.Equal(t, "cpu", frame.Fields[1].Name)
+		assert.Equal(t, data.Labels{"host": "a"}, frame.Fields[1].Labels)
+		assert.Equal(t, []*float64{ptr(1.0), ptr(2.0), nil}, valuesOf[*float64](frame.Fields[1]))
+		assert.Equal(t, data.Labels{"host": "b"}, frame.Fields[2].Labels)
+		assert.Equal(t, []*float64{nil, ptr(3.0), ptr(4.0)}, valuesOf[*float64](frame.Fields[2]))
+		assert.Equal(t, "mem", frame.Fields[3].Name)
+		assert.Equal(t, []*float64{nil, ptr(50.0), nil}, valuesOf[*float64](frame.Fields[3]))
+		assert.Equal(t, []*float64{nil, nil, nil}, valuesOf[*float64](frame.Fields[4]))
+
+		// The custom meta is kept on the merged frame
+		require.NotNil(t, frame.Meta)
+		assert.True(t, frame.Meta.Custom.(*models.TimestreamCustomMeta).HasSeries)
+	})
+
+	t.Run("long", func(t *testing.T) {
+		res := QueryResultToDataFrame(seriesOutput(), models.FormatOptionTimeSeriesLong, models.ResultOptions{})
+		require.NoError(t, res.Error)
+		require.Len(t, res.Frames, 1)
+		frame := res.Frames[0]
+		names := []string{}
+		for _, f := range frame.Fields {
+			names = append(names, f.Name)
+		}
+		assert.Equal(t, []string{"time", "host", "cpu", "mem"}, names)
+		assert.Equal(t, []time.Time{minute(0), minute(1), minute(1), minute(2)}, valuesOf[time.Time](frame.Fields[0]))
+		assert.Equal(t, []*string{ptr("a"), ptr("a"), ptr("b"), ptr("b")}, valuesOf[*string](frame.Fields[1]))
+		assert.Equal(t, []*float64{ptr(1.0), ptr(2.0), ptr(3.0), ptr(4.0)}, valuesOf[*float64](frame.Fields[2]))
+		assert.Equal(t, []*float64{nil, ptr(50.0), nil, nil}, valuesOf[*float64](frame.Fields[3]))
+	})
+
+	for name, format := range map[string]models.FormatQueryOption{"wide": models.FormatOptionTimeSeriesWide, "long": models.FormatOptionTimeSeriesLong} {
+		t.Run(name+" duplicate series", func(t *testing.T) {
+			input := seriesOutput()
+			input.Rows = append(input.Rows, input.Rows[0])
+			res := QueryResultToDataFrame(input, format, models.ResultOptions{})
+			require.NoError(t, res.Error)
+			assert.Len(t, res.Frames, 6)
+			require.Len(t, res.Frames[0].Meta.Notices, 1)
+			assert.Equal(t, data.NoticeSeverityWarning, res.Frames[0].Meta.Notices[0].Severity)
+			assert.Contains(t, res.Frames[0].Meta.Notices[0].Text, "several series are named cpu {host=a}")
+		})
+
+		t.Run(name+" duplicate times", func(t *testing.T) {
+			input := seriesOutput()
+			input.Rows[1].Data[1] = seriesOf("2021-03-14 09:01:00", "3", "2021-03-14 09:01:00", "4")
+			res := QueryResultToDataFrame(input, format, models.ResultOptions{})
+			require.NoError(t, res.Error)
+			assert.Len(t, res.Frames, 4)
+			require.Len(t, res.Frames[0].Meta.Notices, 1)
+			assert.Contains(t, res.Frames[0].Meta.Notices[0].Text, "the series cpu {host=b} has several points at 2021-03-14T09:01:00Z")
+		})
+	}
+
+	t.Run("no series", func(t *testing.T) {
+		input := seriesOutput()
+		input.Rows = nil
+		res := QueryResultToDataFrame(input, models.FormatOptionTimeSeriesWide, models.ResultOptions{})
+		require.NoError(t, res.Error)
+		require.Len(t, res.Frames, 1)
+		assert.Empty(t, res.Frames[0].Fields)
+	})
+}
@@ -0,0 +1,87 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// flightGroup shares one execution between identical queries that run at the
+// same time, e.g. many viewers opening the same dashboard.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	res     *queryResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do calls fn once for all concurrent callers with the same key. The shared
+// execution ignores the deadline of the caller that started it, and keeps running
+// while at least one caller is still waiting for it, so the key must hold every
+// option that changes how fn runs, like its timeout.
+// shared reports whether the result came from a call started by another request.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*queryResult, error)) (res *queryResult, shared bool, err error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, shared := g.flights[key]
+	if !shared {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go func() {
+			defer func() {
+				// A panic must still release every waiter, and not crash the plugin
+				if r := recover(); r != nil {
+					backend.Logger.Error("timestream query panicked", "panic", r, "stack", string(debug.Stack()))
+					f.res, f.err = nil, backend.PluginError(fmt.Errorf("query failed unexpectedly: %v", r))
+				}
+				g.forget(key, f)
+				cancel()
+				close(f.done)
+			}()
+			f.res, f.err = fn(flightCtx)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody is waiting anymore, later callers start a new execution
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			f.cancel()
+		}
+	})
+
+	select {
+	case <-f.done:
+		stop()
+		return f.res, shared, f.err
+	case <-ctx.Done():
+		return nil, shared, ctx.Err()
+	}
+}
+
+func (g *flightGroup) forget(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
@@ -0,0 +1,214 @@
+package timestream
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedClient blocks every query until release is closed
+type gatedClient struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (c *gatedClient) Query(ctx context.Context, _ *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	c.calls.Add(1)
+	select {
+	case <-c.release:
+		return &timestreamquery.QueryOutput{QueryId: aws.String("shared")}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *gatedClient) CancelQuery(context.Context, *timestreamquery.CancelQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	return nil, nil
+}
+
+func waitForWaiters(t *testing.T, g *flightGroup, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for _, f := range g.flights {
+			if f.waiters == n {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+}
+
+func TestExecuteQuery_Deduplicates(t *testing.T) {
+	client := &gatedClient{release: make(chan struct{})}
+	ds := &timestreamDS{Client: client}
+	query := models.QueryModel{RawQuery: "SELECT 1"}
+
+	responses := make([]backend.DataResponse, 3)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = ds.ExecuteQuery(context.Background(), query)
+		}()
+	}
+	waitForWaiters(t, &ds.flights, 3)
+	close(client.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), client.calls.Load())
+	deduplicated := 0
+	for _, dr := range responses {
+		require.NoError(t, dr.Error)
+		meta := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+		assert.Equal(t, "shared", meta.QueryID)
+		if meta.Deduplicated {
+			deduplicated++
+		}
+	}
+	assert.Equal(t, 2, deduplicated)
+	assert.NotSame(t, responses[0].Frames[0], responses[1].Frames[0])
+}
+
+func TestExecuteQuery_DifferentTimeRangesAreNotShared(t *testing.T) {
+	client := &gatedClient{release: make(chan struct{})}
+	close(client.release)
+	ds := &timestreamDS{Client: client}
+
+	now := time.Now()
+	for _, from := range []time.Time{now.Add(-time.Hour), now.Add(-2 * time.Hour)} {
+		dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+			RawQuery:  "SELECT 1",
+			TimeRange: backend.TimeRange{From: from, To: now},
+		})
+		require.NoError(t, dr.Error)
+	}
+	assert.Equal(t, int32(2), client.calls.Load())
+}
+
+func TestExecuteQuery_DifferentTimeoutsAreNotShared(t *testing.T) {
+	client := &gatedClient{release: make(chan struct{})}
+	ds := &timestreamDS{Client: client}
+
+	long := make(chan backend.DataResponse)
+	go func() {
+		long <- ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "SELECT 1"})
+	}()
+	waitForWaiters(t, &ds.flights, 1)
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery:     "SELECT 1",
+		QueryTimeout: models.Duration(20 * time.Millisecond),
+	})
+	assert.ErrorIs(t, dr.Error, context.DeadlineExceeded)
+
+	close(client.release)
+	dr = <-long
+	require.NoError(t, dr.Error)
+	assert.False(t, dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).Deduplicated)
+	assert.Equal(t, int32(2), client.calls.Load())
+}
+
+func TestFlightGroup_Cancellation(t *testing.T) {
+	t.Run("keeps running while a caller waits", func(t *testing.T) {
+		g := &flightGroup{}
+		release := make(chan struct{})
+		fn := func(ctx context.Context) (*queryResult, error) {
+			select {
+			case <-release:
+				return &queryResult{pages: 1}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		ctxA, cancelA := context.WithCancel(context.Background())
+		errA := make(chan error)
+		go func() {
+			_, _, err := g.do(ctxA, "k", fn)
+			errA <- err
+		}()
+		resB := make(chan *queryResult)
+		go func() {
+			res, _, _ := g.do(context.Background(), "k", fn)
+			resB <- res
+		}()
+		waitForWaiters(t, g, 2)
+
+		cancelA()
+		assert.ErrorIs(t, <-errA, context.Canceled)
+
+		close(release)
+		res := <-resB
+		require.NotNil(t, res)
+		assert.Equal(t, 1, res.pages)
+	})
+
+	t.Run("cancels once every caller is gone", func(t *testing.T) {
+		g := &flightGroup{}
+		cancelled := make(chan struct{})
+		fn := func(ctx context.Context) (*queryResult, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return nil, ctx.Err()
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			_, _, _ = g.do(ctx, "k", fn)
+		}()
+		waitForWaiters(t, g, 1)
+		cancel()
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("shared execution was not cancelled")
+		}
+	})
+}
+
+func TestFlightGroup_Panic(t *testing.T) {
+	g := &flightGroup{}
+	release := make(chan struct{})
+	fn := func(context.Context) (*queryResult, error) {
+		<-release
+		panic("boom")
+	}
+
+	errs := make(chan error, 3)
+	for range 3 {
+		go func() {
+			_, _, err := g.do(context.Background(), "k", fn)
+			errs <- err
+		}()
+	}
+	waitForWaiters(t, g, 3)
+	close(release)
+
+	for range 3 {
+		err := <-errs
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "boom")
+		assert.True(t, backend.IsPluginError(err))
+	}
+
+	// The key is free again for later callers
+	res, shared, err := g.do(context.Background(), "k", func(context.Context) (*queryResult, error) {
+		return &queryResult{pages: 1}, nil
+	})
+	require.NoError(t, err)
+	assert.False(t, shared)
+	assert.Equal(t, 1, res.pages)
+}
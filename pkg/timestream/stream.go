@@ -0,0 +1,158 @@
+package timestream
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const streamPathPrefix = "query/"
+
+// streamPage is one message on a query channel: the frames of a page, or the
+// error that ended the stream. Done is set on the last message.
+type streamPage struct {
+	Frames []*data.Frame `json:"frames,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Done   bool          `json:"done"`
+}
+
+// streamRequest is the data sent with a subscription: the query to continue, and a
+// nonce so that every response gets a stream of its own, even for the same query.
+// Subscribers of one channel share a single stream, so a late subscriber of a shared
+// channel would miss the pages sent before it joined.
+type streamRequest struct {
+	Query models.QueryModel `json:"query"`
+	Nonce string            `json:"nonce"`
+}
+
+// streamPath names the channel of a stream after its request
+func streamPath(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+	return streamPathPrefix + hex.EncodeToString(sum[:])
+}
+
+// streamQuery reads the query sent with a subscription, and checks that it belongs to the channel
+func streamQuery(path string, subscription json.RawMessage) (models.QueryModel, error) {
+	req := streamRequest{}
+	var payload string
+	if err := json.Unmarshal(subscription, &payload); err != nil {
+		return req.Query, fmt.Errorf("invalid stream data: %w", err)
+	}
+	if streamPath(payload) != path {
+		return req.Query, fmt.Errorf("the stream data does not match the channel %s", path)
+	}
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		return req.Query, fmt.Errorf("invalid stream query: %w", err)
+	}
+	if req.Query.NextToken == "" {
+		return req.Query, fmt.Errorf("the stream query has no next token")
+	}
+	return req.Query, nil
+}
+
+// attachStream moves the remaining pages of a response to a live channel.
+// The query continues from the executed SQL and the NextToken, which the frontend
+// sends back when it subscribes, so any plugin instance can run the stream.
+// Every response gets its own channel, as its subscriber needs all of the pages.
+func (ds *timestreamDS) attachStream(pCtx backend.PluginContext, query models.QueryModel, dr *backend.DataResponse) {
+	if dr.Error != nil || len(dr.Frames) == 0 || pCtx.DataSourceInstanceSettings == nil {
+		return
+	}
+	frame := dr.Frames[0]
+	meta, ok := frame.Meta.Custom.(*models.TimestreamCustomMeta)
+	if !ok || meta.NextToken == "" {
+		return
+	}
+
+	// The macros are already expanded
+	query.RawQuery = frame.Meta.ExecutedQueryString
+	query.NextToken = meta.NextToken
+	query.AdhocFilters = nil
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		backend.Logger.Warn("unable to stream remaining pages", "error", err.Error())
+		return
+	}
+	payload, err := json.Marshal(streamRequest{Query: query, Nonce: hex.EncodeToString(nonce)})
+	if err != nil {
+		backend.Logger.Warn("unable to stream remaining pages", "error", err.Error())
+		return
+	}
+	meta.Stream = &models.StreamChannel{
+		Path: streamPath(string(payload)),
+		Data: string(payload),
+	}
+
+	// The backend continues the query, the frontend should not
+	meta.NextToken = ""
+}
+
+// SubscribeStream accepts subscriptions that send the query of their channel
+func (ds *timestreamDS) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	if !strings.HasPrefix(req.Path, streamPathPrefix) {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	if _, err := streamQuery(req.Path, req.Data); err != nil {
+		backend.Logger.Debug("rejected stream subscription", "path", req.Path, "error", err.Error())
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// PublishStream is not supported
+func (ds *timestreamDS) PublishStream(_ context.Context, _ *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+}
+
+// RunStream follows the NextToken of a query and sends the frames of every page
+func (ds *timestreamDS) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	query, err := streamQuery(req.Path, req.Data)
+	if err != nil {
+		return err
+	}
+
+	// Cancel the query in Timestream when the last subscriber leaves between pages
+	stopCancel := func() bool { return false }
+	defer func() { stopCancel() }()
+
+	for query.NextToken != "" {
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The page request cancels the query itself while it runs
+		stopCancel()
+		dr := ds.continueQuery(ctx, query)
+		if dr.Error != nil {
+			// Returning an error would make Grafana restart the stream
+			return sendPage(sender, streamPage{Error: dr.Error.Error(), Done: true})
+		}
+
+		query.NextToken = ""
+		if meta, ok := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta); ok {
+			query.NextToken = meta.NextToken
+			if meta.QueryID != "" && query.NextToken != "" {
+				stopCancel = ds.cancelOnDone(ctx, meta.QueryID)
+			}
+		}
+		if err := sendPage(sender, streamPage{Frames: dr.Frames, Done: query.NextToken == ""}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendPage(sender *backend.StreamSender, page streamPage) error {
+	b, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	return sender.SendJSON(b)
+}
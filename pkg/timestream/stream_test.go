@@ -0,0 +1,165 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePacketSender struct {
+	packets []*backend.StreamPacket
+}
+
+func (f *fakePacketSender) Send(p *backend.StreamPacket) error {
+	f.packets = append(f.packets, p)
+	return nil
+}
+
+func TestStreamResults(t *testing.T) {
+	ds := &timestreamDS{Client: &MockClient{testFileNames: []string{"pagination-off_1"}}}
+	pCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: "ts-uid"},
+	}
+
+	res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: pCtx,
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: []byte(`{"rawQuery":"SELECT 1"}`)},
+		},
+	})
+	require.NoError(t, err)
+
+	frame := res.Responses["A"].Frames[0]
+	meta := frame.Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.Empty(t, meta.NextToken)
+	assert.Empty(t, frame.Meta.Channel)
+	require.NotNil(t, meta.Stream)
+	assert.True(t, strings.HasPrefix(meta.Stream.Path, streamPathPrefix))
+	subscription, err := json.Marshal(meta.Stream.Data)
+	require.NoError(t, err)
+
+	// Another plugin instance, like after a restart or behind a load balancer
+	other := &timestreamDS{Client: &MockClient{testFileNames: []string{"pagination-off_2"}}}
+	sub, err := other.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{PluginContext: pCtx, Path: meta.Stream.Path, Data: subscription})
+	require.NoError(t, err)
+	assert.Equal(t, backend.SubscribeStreamStatusOK, sub.Status)
+
+	packets := &fakePacketSender{}
+	err = other.RunStream(context.Background(), &backend.RunStreamRequest{PluginContext: pCtx, Path: meta.Stream.Path, Data: subscription}, backend.NewStreamSender(packets))
+	require.NoError(t, err)
+	require.Len(t, packets.packets, 1)
+
+	page := map[string]any{}
+	require.NoError(t, json.Unmarshal(packets.packets[0].Data, &page))
+	assert.Equal(t, true, page["done"])
+	assert.Len(t, page["frames"], 1)
+}
+
+func TestStreamResults_RejectsOtherQueries(t *testing.T) {
+	ds := &timestreamDS{Client: &MockClient{}}
+	query, err := json.Marshal(streamRequest{Query: models.QueryModel{RawQuery: "SELECT 1", NextToken: "token"}, Nonce: "n"})
+	require.NoError(t, err)
+	path := streamPath(string(query))
+
+	tampered, err := json.Marshal(`{"query":{"rawQuery":"SELECT 2","nextToken":"token"},"nonce":"n"}`)
+	require.NoError(t, err)
+	sub, err := ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: path, Data: tampered})
+	require.NoError(t, err)
+	assert.Equal(t, backend.SubscribeStreamStatusNotFound, sub.Status)
+
+	sub, err = ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: path})
+	require.NoError(t, err)
+	assert.Equal(t, backend.SubscribeStreamStatusNotFound, sub.Status)
+}
+
+func TestStreamResults_EachResponseHasItsOwnStream(t *testing.T) {
+	ds := &timestreamDS{Client: &MockClient{testFileNames: []string{"pagination-off_1", "pagination-off_2", "pagination-off_1", "pagination-off_2"}}}
+	pCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: "ts-uid"},
+	}
+	query := func() *models.StreamChannel {
+		res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+			PluginContext: pCtx,
+			Queries: []backend.DataQuery{
+				{RefID: "A", JSON: []byte(`{"rawQuery":"SELECT 1"}`)},
+			},
+		})
+		require.NoError(t, err)
+		meta := res.Responses["A"].Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+		require.NotNil(t, meta.Stream)
+		return meta.Stream
+	}
+	follow := func(stream *models.StreamChannel) []*backend.StreamPacket {
+		subscription, err := json.Marshal(stream.Data)
+		require.NoError(t, err)
+		packets := &fakePacketSender{}
+		err = ds.RunStream(context.Background(), &backend.RunStreamRequest{PluginContext: pCtx, Path: stream.Path, Data: subscription}, backend.NewStreamSender(packets))
+		require.NoError(t, err)
+		return packets.packets
+	}
+
+	// The second viewer subscribes after the first stream has sent its pages
+	first := query()
+	assert.Len(t, follow(first), 1)
+	second := query()
+	assert.NotEqual(t, first.Path, second.Path)
+	packets := follow(second)
+	require.Len(t, packets, 1)
+	page := map[string]any{}
+	require.NoError(t, json.Unmarshal(packets[0].Data, &page))
+	assert.Len(t, page["frames"], 1)
+}
+
+func TestStreamResults_SendsTheExecutedSQL(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{QueryId: aws.String("q")}}
+	ds := &timestreamDS{Client: client}
+	payload, err := json.Marshal(streamRequest{Query: models.QueryModel{RawQuery: `SELECT '$__from', '${__to}'`, NextToken: "token"}, Nonce: "n"})
+	require.NoError(t, err)
+	subscription, err := json.Marshal(string(payload))
+	require.NoError(t, err)
+
+	packets := &fakePacketSender{}
+	err = ds.RunStream(context.Background(), &backend.RunStreamRequest{Path: streamPath(string(payload)), Data: subscription}, backend.NewStreamSender(packets))
+	require.NoError(t, err)
+	require.Len(t, client.calls.runQuery, 1)
+	assert.Equal(t, `SELECT '$__from', '${__to}'`, *client.calls.runQuery[0].QueryString)
+	assert.Equal(t, "token", *client.calls.runQuery[0].NextToken)
+}
+
+func TestStreamResults_NoMorePages(t *testing.T) {
+	ds := &timestreamDS{Client: &MockClient{testFileNames: []string{"select-consts"}}}
+	res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: "ts-uid"},
+		},
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: []byte(`{"rawQuery":"SELECT 1"}`)},
+		},
+	})
+	require.NoError(t, err)
+	meta := res.Responses["A"].Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.Nil(t, meta.Stream)
+}
+
+func TestStreamResults_WaitForResult(t *testing.T) {
+	ds := &timestreamDS{Client: &MockClient{testFileNames: []string{"pagination-off_1", "pagination-off_2"}}}
+	res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: "ts-uid"},
+		},
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: []byte(`{"rawQuery":"SELECT 1","waitForResult":true}`)},
+		},
+	})
+	require.NoError(t, err)
+	meta := res.Responses["A"].Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.Nil(t, meta.Stream)
+}
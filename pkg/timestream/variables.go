@@ -0,0 +1,216 @@
+package timestream
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// Grafana global variables written with braces, like ${__from:date:iso}. The browser
+// replaces them before the query is sent, but alerting and public dashboards do not.
+const variablePrefix = "${__"
+
+// globalVariables are the braced variables resolved on the backend, the others
+// (like ${__user.login}) are left untouched
+var globalVariables = map[string]bool{
+	"from":          true,
+	"to":            true,
+	"range":         true,
+	"range_s":       true,
+	"range_ms":      true,
+	"interval":      true,
+	"interval_ms":   true,
+	"rate_interval": true,
+}
+
+// variable expands the braced variable starting at pos, and returns the position
+// after its closing brace. Unknown variables are returned as written.
+func (p *macroParser) variable(pos, end int) (string, int, error) {
+	closing := strings.IndexByte(p.query[pos:end], '}')
+	if closing < 0 {
+		return "", 0, p.errorAt(pos, fmt.Errorf("unterminated variable"))
+	}
+	next := pos + closing + 1
+	name, format, _ := strings.Cut(p.query[pos+len(variablePrefix):next-1], ":")
+	if !globalVariables[name] {
+		return p.query[pos:next], next, nil
+	}
+
+	var value string
+	var err error
+	switch name {
+	case "from":
+		value, err = formatDateVariable(p.model.TimeRange.From, format)
+	case "to":
+		value, err = formatDateVariable(p.model.TimeRange.To, format)
+	default:
+		value, err = macroFuncs[name](p.model, p.settings, nil)
+		if err == nil && format != "" && format != "raw" && format != "text" {
+			err = fmt.Errorf("invalid format: %q", format)
+		}
+	}
+	if err != nil {
+		return "", 0, p.errorAt(pos, fmt.Errorf("${__%s}: %w", name, err))
+	}
+	return value, next, nil
+}
+
+// expandVariables returns query[start:end] with only its braced variables replaced,
+// for string literals where macros are not expanded
+func (p *macroParser) expandVariables(start, end int) (string, error) {
+	var sb strings.Builder
+	for i := start; i < end; {
+		pos := strings.Index(p.query[i:end], variablePrefix)
+		if pos < 0 {
+			sb.WriteString(p.query[i:end])
+			break
+		}
+		pos += i
+		sb.WriteString(p.query[i:pos])
+		value, next, err := p.variable(pos, end)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(value)
+		i = next
+	}
+	return sb.String(), nil
+}
+
+func macroFrom(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	return fmt.Sprintf("%d", model.TimeRange.From.UnixMilli()), nil
+}
+
+func macroTo(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	return fmt.Sprintf("%d", model.TimeRange.To.UnixMilli()), nil
+}
+
+// macroRange is the length of the time range in its largest unit, like 6h
+func macroRange(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	return secondsToHms(math.Round(model.TimeRange.Duration().Seconds())), nil
+}
+
+func macroRangeSeconds(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	return fmt.Sprintf("%d", int64(math.Round(model.TimeRange.Duration().Seconds()))), nil
+}
+
+func macroRangeMs(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	return fmt.Sprintf("%d", model.TimeRange.Duration().Milliseconds()), nil
+}
+
+// secondsToHms writes a duration the way Grafana writes $__range
+func secondsToHms(seconds float64) string {
+	units := []struct {
+		suffix  string
+		seconds float64
+		modulo  float64
+	}{
+		{"y", 31536000, 0},
+		{"d", 86400, 31536000},
+		{"h", 3600, 86400},
+		{"m", 60, 3600},
+		{"s", 1, 60},
+	}
+	for _, u := range units {
+		v := seconds
+		if u.modulo > 0 {
+			v = math.Mod(v, u.modulo)
+		}
+		if n := math.Floor(v / u.seconds); n > 0 {
+			return fmt.Sprintf("%d%s", int64(n), u.suffix)
+		}
+	}
+	if ms := math.Floor(seconds * 1000); ms > 0 {
+		return fmt.Sprintf("%dms", int64(ms))
+	}
+	return "less than a millisecond"
+}
+
+// formatDateVariable formats $__from and $__to like Grafana: epoch milliseconds
+// by default, and with date, an ISO 8601 string, epoch seconds or a moment.js format
+func formatDateVariable(t time.Time, format string) (string, error) {
+	kind, layout, _ := strings.Cut(format, ":")
+	switch {
+	case format == "" || format == "raw" || format == "text":
+		return fmt.Sprintf("%d", t.UnixMilli()), nil
+	case kind != "date":
+		return "", fmt.Errorf("invalid format: %q", format)
+	case layout == "" || layout == "iso":
+		return t.UTC().Format("2006-01-02T15:04:05.000Z"), nil
+	case layout == "seconds":
+		return fmt.Sprintf("%d", t.Unix()), nil
+	}
+	return formatMoment(t.UTC(), layout), nil
+}
+
+// Moment.js tokens, longest first so YYYY is not read as YY twice
+var momentTokens = []struct {
+	token  string
+	layout string
+}{
+	{"YYYY", "2006"},
+	{"MMMM", "January"},
+	{"dddd", "Monday"},
+	{"MMM", "Jan"},
+	{"ddd", "Mon"},
+	{"SSS", ".000"},
+	{"YY", "06"},
+	{"MM", "01"},
+	{"DD", "02"},
+	{"HH", "15"},
+	{"hh", "03"},
+	{"mm", "04"},
+	{"ss", "05"},
+	{"ZZ", "-0700"},
+	{"M", "1"},
+	{"D", "2"},
+	{"h", "3"},
+	{"m", "4"},
+	{"s", "5"},
+	{"A", "PM"},
+	{"a", "pm"},
+	{"Z", "-07:00"},
+}
+
+// formatMoment formats t with the common moment.js tokens. Text in square brackets
+// and characters that are not tokens are written as is.
+func formatMoment(t time.Time, format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); {
+		if format[i] == '[' {
+			if closing := strings.IndexByte(format[i:], ']'); closing > 0 {
+				sb.WriteString(format[i+1 : i+closing])
+				i += closing + 1
+				continue
+			}
+		}
+		switch {
+		case strings.HasPrefix(format[i:], "X"):
+			sb.WriteString(fmt.Sprintf("%d", t.Unix()))
+			i++
+			continue
+		case strings.HasPrefix(format[i:], "x"):
+			sb.WriteString(fmt.Sprintf("%d", t.UnixMilli()))
+			i++
+			continue
+		}
+		matched := false
+		for _, tok := range momentTokens {
+			if strings.HasPrefix(format[i:], tok.token) {
+				// Go writes fractional seconds with their separator
+				sb.WriteString(strings.TrimPrefix(t.Format(tok.layout), "."))
+				i += len(tok.token)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			sb.WriteByte(format[i])
+			i++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,91 @@
+package timestream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolateGlobalVariables(t *testing.T) {
+	from := time.Date(2020, 7, 13, 20, 19, 9, 254_000_000, time.UTC)
+	timeRange := backend.TimeRange{From: from, To: from.Add(6 * time.Hour)}
+
+	tests := []struct {
+		name   string
+		sql    string
+		expect string
+	}{
+		{"from", `$__from`, `1594671549254`},
+		{"to", `$__to`, `1594693149254`},
+		{"braced", `${__from} ${__to:raw}`, `1594671549254 1594693149254`},
+		{"date", `${__from:date}`, `2020-07-13T20:19:09.254Z`},
+		{"iso", `${__from:date:iso}`, `2020-07-13T20:19:09.254Z`},
+		{"seconds", `${__to:date:seconds}`, `1594693149`},
+		{"moment format", `${__from:date:YYYY-MM-DD HH:mm:ss.SSS}`, `2020-07-13 20:19:09.254`},
+		{"moment literal", `${__from:date:[Q]YY MMM D, h A}`, `Q20 Jul 13, 8 PM`},
+		{"range", `$__range ${__range}`, `6h 6h`},
+		{"range seconds", `$__range_s ${__range_ms}`, `21600 21600000`},
+		{"interval", `${__interval} ${__interval_ms}`, `60000ms 60000ms`},
+		{"rate interval", `$__rate_interval ${__rate_interval}`, `75000ms 75000ms`},
+		{"inside quotes", `time > from_iso8601_timestamp('${__from:date:iso}')`, `time > from_iso8601_timestamp('2020-07-13T20:19:09.254Z')`},
+		{"macros stay quoted", `'$__timeFilter ${__range}'`, `'$__timeFilter 6h'`},
+		{"not in comments", `-- ${__from}`, `-- ${__from}`},
+		{"left alone", `${__user.login} ${__dashboard}`, `${__user.login} ${__dashboard}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: tt.sql, TimeRange: timeRange, Interval: time.Minute}
+			text, err := Interpolate(query, models.DatasourceSettings{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, text)
+		})
+	}
+
+	for _, sql := range []string{`${__from`, `${__from:json}`, `${__range:date}`, `$__from(1)`} {
+		t.Run("invalid "+sql, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: sql, TimeRange: timeRange, Interval: time.Minute}
+			_, err := Interpolate(query, models.DatasourceSettings{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestInterpolateRateInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    time.Duration
+		minInterval time.Duration
+		expect      string
+	}{
+		{"default scrape interval", 10 * time.Second, 0, `60000ms`},
+		{"long interval", 5 * time.Minute, 0, `315000ms`},
+		{"min interval as scrape interval", time.Minute, time.Minute, `240000ms`},
+		{"long interval with min interval", 10 * time.Minute, time.Minute, `660000ms`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := models.QueryModel{RawQuery: `bin(time, $__rate_interval)`, Interval: tt.interval}
+			text, err := Interpolate(query, models.DatasourceSettings{MinInterval: models.Duration(tt.minInterval)})
+			require.NoError(t, err)
+			assert.Equal(t, "bin(time, "+tt.expect+")", text)
+		})
+	}
+}
+
+func TestSecondsToHms(t *testing.T) {
+	tests := map[float64]string{
+		0:        "less than a millisecond",
+		0.5:      "500ms",
+		45:       "45s",
+		5400:     "1h",
+		86400:    "1d",
+		31536000: "1y",
+	}
+	for seconds, expect := range tests {
+		assert.Equal(t, expect, secondsToHms(seconds))
+	}
+}
@@ -2,6 +2,7 @@ import { ScopedVars } from '@grafana/data';
 import * as runtime from '@grafana/runtime';
 
 import { mockDatasource, mockQuery } from './__mocks__/datasource';
+import { mergeStats, resolveTimezone, scanMacroArgs } from './DataSource';
 
 describe('DataSource', () => {
   describe('applyTemplateVariables', () => {
@@ -46,6 +47,19 @@ describe('DataSource', () => {
       expect(res.rawQuery).toEqual(`select * from foo where var in ('foo','bar')`);
     });
 
+    it('should quote every value of the filter macros', () => {
+      const res = mockDatasource.applyTemplateVariables(
+        {
+          ...mockQuery,
+          rawQuery: `WHERE $__in(region, $simple) AND $__dimensionFilter(az, $multiple) AND $__in(host, $odd) AND x = $simple`,
+        },
+        { ...scopedVars, $odd: { value: "a,b'c" } }
+      );
+      expect(res.rawQuery).toEqual(
+        `WHERE $__in(region, 'foo') AND $__dimensionFilter(az, 'foo','bar') AND $__in(host, 'a,b''c') AND x = foo`
+      );
+    });
+
     it('should replace __interval interpolated variables with their original string', () => {
       replaceMock.mockClear();
       mockDatasource.applyTemplateVariables(
@@ -72,4 +86,47 @@ describe('DataSource', () => {
       expect(replaceMock.mock.calls[3][1].__from).toEqual({ value: 3000 });
     });
   });
+
+  describe('scanMacroArgs', () => {
+    it('should find the first separator and the closing parenthesis', () => {
+      expect(scanMacroArgs(`$__in(f(a, b), 'x,)', y) AND`, 5)).toEqual({ comma: 13, close: 23 });
+      expect(scanMacroArgs(`$__in(region)`, 5)).toEqual({ comma: -1, close: 12 });
+      expect(scanMacroArgs(`$__in(region, 'x`, 5)).toBeUndefined();
+    });
+  });
+
+  describe('resolveTimezone', () => {
+    it('should resolve the dashboard timezone to an IANA name', () => {
+      expect(resolveTimezone('utc')).toEqual('UTC');
+      expect(resolveTimezone('Europe/Berlin')).toEqual('Europe/Berlin');
+      expect(resolveTimezone('browser')).toEqual(Intl.DateTimeFormat().resolvedOptions().timeZone);
+      expect(resolveTimezone(undefined)).toEqual(Intl.DateTimeFormat().resolvedOptions().timeZone);
+    });
+  });
+
+  describe('mergeStats', () => {
+    it('should add the stats of a streamed page to the backend stats', () => {
+      const first = [
+        { displayName: 'Bytes scanned', unit: 'decbytes', value: 100 },
+        { displayName: 'Pages', unit: 'none', value: 1 },
+        { displayName: 'Rows', unit: 'none', value: 10 },
+      ];
+      const page = [
+        { displayName: 'Bytes scanned', unit: 'decbytes', value: 300 },
+        { displayName: 'Pages', unit: 'none', value: 1 },
+        { displayName: 'Rows', unit: 'none', value: 5 },
+      ];
+      expect(mergeStats(first, page)).toEqual([
+        { displayName: 'Bytes scanned', unit: 'decbytes', value: 300 },
+        { displayName: 'Pages', unit: 'none', value: 2 },
+        { displayName: 'Rows', unit: 'none', value: 15 },
+      ]);
+      expect(first[2].value).toEqual(10);
+    });
+
+    it('should keep the backend stats when a page has none', () => {
+      const first = [{ displayName: 'Rows', unit: 'none', value: 10 }];
+      expect(mergeStats(first, undefined)).toEqual(first);
+    });
+  });
 });
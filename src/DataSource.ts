@@ -1,23 +1,26 @@
 import {
+  AdHocVariableFilter,
   DataFrame,
+  dataFrameFromJSON,
   DataQueryRequest,
   DataQueryResponse,
+  DataSourceGetTagValuesOptions,
   DataSourceInstanceSettings,
-  getValueFormat,
+  isLiveChannelMessageEvent,
+  LiveChannelScope,
+  LoadingState,
   MetricFindValue,
   QueryResultMetaStat,
   ScopedVars,
   TimeRange,
 } from '@grafana/data';
-import { DataSourceWithBackend, getTemplateSrv } from '@grafana/runtime';
+import { DataSourceWithBackend, getGrafanaLiveSrv, getTemplateSrv, GrafanaLiveSrv } from '@grafana/runtime';
 import { appendMatchingFrames } from 'appendFrames';
-import { getRequestLooper, MultiRequestTracker } from 'requestLooper';
-import { lastValueFrom, merge, Observable, of } from 'rxjs';
-import { map } from 'rxjs/operators';
+import { combineLatest, lastValueFrom, Observable, of } from 'rxjs';
+import { filter, map, startWith, switchMap, takeWhile } from 'rxjs/operators';
 
-import { TimestreamCustomMeta, TimestreamOptions, TimestreamQuery } from './types';
+import { StreamPage, TimestreamCustomMeta, TimestreamOptions, TimestreamQuery, TimestreamStream } from './types';
 
-let requestCounter = 100;
 export class DataSource extends DataSourceWithBackend<TimestreamQuery, TimestreamOptions> {
   // Easy access for QueryEditor
   options: TimestreamOptions;
@@ -69,11 +72,42 @@ export class DataSource extends DataSourceWithBackend<TimestreamQuery, Timestrea
     return quotedValues.join(',');
   };
 
+  // Values of $__in and $__dimensionFilter are always quoted, so a single value
+  // holding a comma or a quote stays one value
+  private quoteFilterValues = (value: string | string[] | number) => {
+    const values = Array.isArray(value) ? value : [value];
+    return values.map((v) => this.quoteLiteral(String(v))).join(',');
+  };
+
   private quoteLiteral(value: string) {
     return "'" + value.replace(/'/g, "''") + "'";
   }
 
-  applyTemplateVariables(query: TimestreamQuery, scopedVars: ScopedVars): TimestreamQuery {
+  // Replaces the variables in the values of the filter macros, after their column
+  private interpolateFilterMacros(sql: string, scopedVars: ScopedVars): string {
+    const templateSrv = getTemplateSrv();
+    const macro = /\$__(in|dimensionFilter)\s*\(/g;
+    let result = '';
+    let last = 0;
+    let match: RegExpExecArray | null;
+    while ((match = macro.exec(sql))) {
+      const args = scanMacroArgs(sql, match.index + match[0].length - 1);
+      if (!args || args.comma < 0) {
+        continue;
+      }
+      result += sql.slice(last, args.comma + 1);
+      result += templateSrv.replace(sql.slice(args.comma + 1, args.close), scopedVars, this.quoteFilterValues);
+      last = args.close;
+      macro.lastIndex = args.close;
+    }
+    return result + sql.slice(last);
+  }
+
+  applyTemplateVariables(
+    query: TimestreamQuery,
+    scopedVars: ScopedVars,
+    filters?: AdHocVariableFilter[]
+  ): TimestreamQuery {
     if (!query.rawQuery) {
       return query;
     }
@@ -96,213 +130,112 @@ export class DataSource extends DataSourceWithBackend<TimestreamQuery, Timestrea
       database: templateSrv.replace(query.database || '', scopedVars),
       table: templateSrv.replace(query.table || '', scopedVars),
       measure: templateSrv.replace(query.measure || '', scopedVars),
-      rawQuery: templateSrv.replace(query.rawQuery, variables, this.interpolateVariable),
+      rawQuery: templateSrv.replace(
+        this.interpolateFilterMacros(query.rawQuery, variables),
+        variables,
+        this.interpolateVariable
+      ),
+      // Expanded by $__adhocFilters on the backend
+      adhocFilters: filters ?? templateSrv.getAdhocFilters(this.name),
     };
   }
 
+  // Ad hoc filter keys are the dimensions of the default table, and the measure name
+  async getTagKeys(): Promise<MetricFindValue[]> {
+    const keys = await this.postResource<string[]>('tag-keys', {});
+    return keys.map((text) => ({ text }));
+  }
+
+  async getTagValues(options: DataSourceGetTagValuesOptions<TimestreamQuery>): Promise<MetricFindValue[]> {
+    const values = await this.postResource<string[]>('tag-values', {
+      key: options.key,
+      from: options.timeRange?.from.valueOf(),
+      to: options.timeRange?.to.valueOf(),
+    });
+    return values.map((text) => ({ text }));
+  }
+
   query(request: DataQueryRequest<TimestreamQuery>): Observable<DataQueryResponse> {
-    const targets = request.targets;
-    if (!targets.length) {
+    if (!request.targets.length) {
       return of({ data: [] });
     }
-    if (targets.some((t) => t.waitForResult)) {
-      // Defaults to the common behavior of waiting for all the queries to be finished
-      // before rendering
-      return super.query(request);
-    }
-    const all: Array<Observable<DataQueryResponse>> = [];
-    for (let target of targets) {
-      if (target.hide) {
-        continue;
-      }
-      all.push(this.doSingle(target, request));
-    }
-    if (all.length === 1) {
-      return all[0];
-    }
-    return merge(...all);
+    // The backend expands $__timezone from the dashboard timezone
+    const timezone = resolveTimezone(request.timezone);
+    const targets = request.targets.map((t) => ({ ...t, timezone }));
+    request = { ...request, targets };
+    // Queries that do not wait for all the pages return the first one, and the
+    // backend streams the others over the channel in the frame meta
+    return super.query(request).pipe(switchMap((rsp) => this.streamPages(rsp)));
   }
 
-  doSingle(target: TimestreamQuery, request: DataQueryRequest<TimestreamQuery>): Observable<DataQueryResponse> {
-    let tracker: TimestreamCustomMeta | undefined = undefined;
-    let queryId: string | undefined = undefined;
-    let allData: DataFrame[] = [];
-    return getRequestLooper(
-      { ...request, targets: [target], requestId: `aws_ts_${requestCounter++}` },
-      {
-        // Check for a "nextToken" in the response
-        getNextQuery: (rsp: DataQueryResponse) => {
-          if (rsp.data?.length) {
-            const first = rsp.data[0] as DataFrame;
-            const meta = first.meta?.custom as TimestreamCustomMeta;
-            if (meta && meta.nextToken) {
-              queryId = meta.queryId;
-
-              return {
-                refId: first.refId,
-                rawQuery: first.meta?.executedQueryString,
-                nextToken: meta.nextToken,
-              } as TimestreamQuery;
-            }
-          }
-          return undefined;
-        },
-
-        /**
-         * The original request
-         */
-        query: (request: DataQueryRequest<TimestreamQuery>) => {
-          return super.query(request);
-        },
-
-        /**
-         * Process the results
-         */
-        process: (t: MultiRequestTracker, data: DataFrame[], isLast: boolean) => {
-          const meta = data[0]?.meta?.custom as TimestreamCustomMeta;
-          if (!meta) {
-            return allData.length ? allData : data; // NOOP
-          }
-          const valueFormat = getValueFormat('decbytes');
-
-          // Single request
-          meta.fetchStartTime = t.fetchStartTime;
-          meta.fetchEndTime = t.fetchEndTime;
-          meta.fetchTime = t.fetchEndTime! - t.fetchStartTime!;
-
-          if (meta.hasSeries || !allData.length) {
-            for (const frame of data) {
-              if (frame.fields.length > 0) {
-                allData.push(frame);
-              }
-            }
-          } else {
-            if (data.length > 1) {
-              console.log('non timeseries should have a single frame', data);
-            }
-            const append = data[0];
-            if (append.length > 0) {
-              allData = appendMatchingFrames(allData, data);
-            }
-          }
+  /**
+   * Follows the channels of the queries that have more pages, and appends each page as it arrives
+   */
+  private streamPages(rsp: DataQueryResponse): Observable<DataQueryResponse> {
+    const live = getGrafanaLiveSrv();
+    const queries = new Map<string, DataFrame[]>();
+    for (const frame of rsp.data as DataFrame[]) {
+      const refId = frame.refId ?? '';
+      queries.set(refId, [...(queries.get(refId) ?? []), frame]);
+    }
+    if (!live || ![...queries.values()].some(getStream)) {
+      return of(rsp);
+    }
 
-          // Empty results
-          if (!allData[0]?.meta) {
-            return data;
-          }
+    const results = [...queries.entries()].map(([refId, frames]) => {
+      const stream = getStream(frames);
+      return stream ? this.followStream(live, refId, frames, stream) : of<StreamedQuery>({ refId, frames, done: true });
+    });
+    return combineLatest(results).pipe(
+      map((streams) => {
+        const errors = streams.filter((s) => s.error).map((s) => ({ refId: s.refId, message: s.error }));
+        return {
+          ...rsp,
+          data: streams.flatMap((s) => s.frames),
+          errors: [...(rsp.errors ?? []), ...errors],
+          state: streams.every((s) => s.done) ? LoadingState.Done : LoadingState.Streaming,
+        };
+      })
+    );
+  }
 
-          if (tracker) {
-            // Additional request
-            if (!tracker.subs?.length) {
-              const { subs, nextToken, queryId, ...rest } = tracker;
-              (rest as any).requestNumber = 1;
-              tracker.subs?.push(rest as TimestreamCustomMeta);
-            }
-            for (const m of tracker.subs!) {
-              delete m.nextToken; // not useful in the
-            }
-            delete (meta as any).queryId;
-            (meta as any).requestNumber = tracker.subs!.length + 1;
-
-            tracker.subs!.push(meta);
-            tracker.fetchEndTime = t.fetchEndTime;
-            tracker.fetchTime = t.fetchEndTime! - tracker.fetchStartTime!;
-            tracker.executionFinishTime = meta.executionFinishTime;
-
-            allData[0].meta!.custom = tracker;
-          } else {
-            // First request
-            tracker = {
-              ...t,
-              ...meta,
-              subs: [],
-            } as TimestreamCustomMeta;
+  private followStream(
+    live: GrafanaLiveSrv,
+    refId: string,
+    first: DataFrame[],
+    stream: TimestreamStream
+  ): Observable<StreamedQuery> {
+    const meta = first[0].meta?.custom as TimestreamCustomMeta;
+    let frames = first;
+    return live
+      .getStream<StreamPage>({
+        scope: LiveChannelScope.DataSource,
+        namespace: this.uid,
+        path: stream.path,
+        data: stream.data,
+      })
+      .pipe(
+        filter(isLiveChannelMessageEvent),
+        map((event) => {
+          const page = event.message;
+          if (page.error) {
+            return { refId, frames, done: true, error: page.error };
           }
-
-          // Calculate stats
-          if (isLast && tracker.executionStartTime && tracker.executionFinishTime) {
-            delete tracker.nextToken;
-
-            const tsTime = tracker.executionFinishTime - tracker.executionStartTime;
-            if (tsTime > 0) {
-              const stats: QueryResultMetaStat[] = [];
-              if (tracker.subs && tracker.subs.length) {
-                stats.push({
-                  displayName: 'HTTP request count',
-                  value: tracker.subs.length,
-                  unit: 'none',
-                });
-              }
-              stats.push({
-                displayName: 'Execution time (Grafana server ⇆ Timestream)',
-                value: tsTime,
-                unit: 'ms',
-                decimals: 2,
-              });
-              if (tracker.fetchStartTime) {
-                tracker.fetchEndTime = Date.now();
-                const dsTime = tracker.fetchEndTime - tracker.fetchStartTime;
-                tracker.fetchTime = dsTime - tsTime;
-                if (dsTime > tsTime) {
-                  stats.push({
-                    displayName: 'Fetch time (Browser ⇆ Grafana server w/o Timestream)',
-                    value: tracker.fetchTime,
-                    unit: 'ms',
-                    decimals: 2,
-                  });
-                  stats.push({
-                    displayName: 'Fetch overhead',
-                    value: (tracker.fetchTime / dsTime) * 100,
-                    unit: 'percent', // 0 - 100
-                  });
-                }
-              }
-              if (tracker.status.CumulativeBytesMetered) {
-                const v = valueFormat(tracker.status.CumulativeBytesMetered, 2, 1024);
-                stats.push({
-                  displayName: 'Cumulative bytes metered',
-                  value: Number(v.text),
-                  unit: v.suffix?.trimStart(),
-                  decimals: 2,
-                });
-              }
-              if (tracker.status.CumulativeBytesScanned) {
-                const v = valueFormat(tracker.status.CumulativeBytesScanned, 2, 1024);
-                stats.push({
-                  displayName: 'Cumulative bytes scanned',
-                  value: Number(v.text),
-                  unit: v.suffix?.trimStart(),
-                  decimals: 2,
-                });
-              }
-              allData[0].meta!.stats = stats;
-            }
+          const pageFrames = (page.frames ?? []).map((f) => ({ ...dataFrameFromJSON(f), refId }));
+          const stats = mergeStats(frames[0]?.meta?.stats, pageFrames[0]?.meta?.stats);
+          for (const f of pageFrames) {
+            // The stats of the query are kept on its first frame
+            f.meta = { ...f.meta, stats: undefined };
           }
-          return allData;
-        },
-
-        /**
-         * Callback that gets executed when unsubscribed
-         */
-        onCancel: (tracker: MultiRequestTracker) => {
-          if (queryId) {
-            console.log('Cancelling running timestream query');
-
-            // tracker.killed = true;
-            this.postResource(`cancel`, {
-              queryId,
-            })
-              .then((v) => {
-                console.log('Timestream query Canceled:', v);
-              })
-              .catch((err) => {
-                err.isHandled = true; // avoid the popup
-                console.log('error killing', err);
-              });
+          frames = appendPage(frames, pageFrames, meta?.hasSeries);
+          if (frames[0]) {
+            frames[0].meta = { ...frames[0].meta, stats };
           }
-        },
-      }
-    );
+          return { refId, frames, done: page.done };
+        }),
+        takeWhile((s) => !s.done, true),
+        startWith({ refId, frames, done: false })
+      );
   }
 
   //----------------------------------------------
@@ -338,6 +271,47 @@ export class DataSource extends DataSourceWithBackend<TimestreamQuery, Timestrea
   }
 }
 
+interface StreamedQuery {
+  refId?: string;
+  frames: DataFrame[];
+  done: boolean;
+  error?: string;
+}
+
+function getStream(frames: DataFrame[]): TimestreamStream | undefined {
+  return (frames[0]?.meta?.custom as TimestreamCustomMeta | undefined)?.stream;
+}
+
+// appendPage adds the frames of the next page: time series as more frames, tables as more rows
+export function appendPage(frames: DataFrame[], page: DataFrame[], hasSeries?: boolean): DataFrame[] {
+  if (hasSeries || !frames.length) {
+    return [...frames, ...page.filter((f) => f.fields.length > 0)];
+  }
+  if (page.length > 1) {
+    console.log('non timeseries should have a single frame', page);
+  }
+  return page[0]?.length ? appendMatchingFrames(frames, page) : frames;
+}
+
+// Timestream reports the bytes of a query cumulatively, the other stats add up over pages
+const cumulativeStats = ['Bytes scanned', 'Bytes metered'];
+
+// mergeStats adds the backend stats of a streamed page to the stats of the previous pages
+export function mergeStats(stats: QueryResultMetaStat[] = [], page: QueryResultMetaStat[] = []): QueryResultMetaStat[] {
+  const merged = stats.map((s) => ({ ...s }));
+  for (const stat of page) {
+    const existing = merged.find((s) => s.displayName === stat.displayName);
+    if (!existing) {
+      merged.push({ ...stat });
+    } else if (cumulativeStats.includes(stat.displayName)) {
+      existing.value = Math.max(existing.value, stat.value);
+    } else {
+      existing.value += stat.value;
+    }
+  }
+  return merged;
+}
+
 export function getNextTokenMeta(rsp: DataQueryResponse): TimestreamCustomMeta | undefined {
   if (rsp.data?.length) {
     const first = rsp.data[0] as DataFrame;
@@ -348,3 +322,41 @@ export function getNextTokenMeta(rsp: DataQueryResponse): TimestreamCustomMeta |
   }
   return undefined;
 }
+
+// resolveTimezone turns the dashboard timezone into an IANA name
+export function resolveTimezone(timezone?: string): string {
+  if (!timezone || timezone === 'browser') {
+    return Intl.DateTimeFormat().resolvedOptions().timeZone;
+  }
+  if (timezone === 'utc') {
+    return 'UTC';
+  }
+  return timezone;
+}
+
+// scanMacroArgs finds the first argument separator and the closing parenthesis of the
+// macro arguments opened at open. Quoted strings may hold commas and parentheses.
+export function scanMacroArgs(sql: string, open: number): { comma: number; close: number } | undefined {
+  let depth = 0;
+  let comma = -1;
+  for (let i = open; i < sql.length; i++) {
+    const c = sql[i];
+    if (c === "'" || c === '"') {
+      const closing = sql.indexOf(c, i + 1);
+      if (closing < 0) {
+        return undefined;
+      }
+      i = closing;
+    } else if (c === '(') {
+      depth++;
+    } else if (c === ')') {
+      depth--;
+      if (depth === 0) {
+        return { comma, close: i };
+      }
+    } else if (c === ',' && depth === 1 && comma < 0) {
+      comma = i;
+    }
+  }
+  return undefined;
+}
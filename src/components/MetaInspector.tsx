@@ -19,6 +19,7 @@ export function MetaInspector(props: Props) {
       <div key={idx}>
         <h3>Query ID</h3>
         <pre>{custom.queryId}</pre>
+        {custom.cacheHit && <p>Results served from the datasource cache</p>}
         {custom.nextToken && (
           <>
             <h3>Next Token</h3>
@@ -1,10 +1,17 @@
 import { ResourceSelector, QueryEditorHeader } from '@grafana/aws-sdk';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
-import { Select, Switch, useStyles2 } from '@grafana/ui';
+import { Input, Select, Switch, useStyles2 } from '@grafana/ui';
 import React, { useEffect, useState } from 'react';
 
 import { DataSource } from '../DataSource';
-import { FormatOptions, SelectableFormatOptions, TimestreamOptions, TimestreamQuery } from '../types';
+import {
+  ArrayModes,
+  FormatOptions,
+  SelectableArrayModes,
+  SelectableFormatOptions,
+  TimestreamOptions,
+  TimestreamQuery,
+} from '../types';
 import { sampleQueries } from './samples';
 import { selectors } from './selectors';
 import SQLEditor from './SQLEditor';
@@ -41,6 +48,23 @@ export function QueryEditor(props: Props) {
     onChange({ ...query, waitForResult: !query.waitForResult });
   };
 
+  const onFlattenRowsChange = () => {
+    onChange({ ...query, flattenRows: !query.flattenRows });
+  };
+
+  const onArrayModeChange = (e: SelectableValue<ArrayModes>) => {
+    onChange({ ...query, explodeArrays: e.value || undefined });
+    onRunQuery();
+  };
+
+  const onTimeShiftChange = (e: React.FocusEvent<HTMLInputElement>) => {
+    const timeShift = e.currentTarget.value.trim() || undefined;
+    if (timeShift !== query.timeShift) {
+      onChange({ ...query, timeShift });
+      onRunQuery();
+    }
+  };
+
   const onChangeSelector = (prop: QueryProperties) => (e: SelectableValue | null) => {
     onChange({ ...query, [prop]: e?.value });
   };
@@ -167,6 +191,35 @@ export function QueryEditor(props: Props) {
               />
             </EditorField>
           </EditorFieldGroup>
+          <EditorFieldGroup>
+            <EditorField label="Flatten rows" tooltip="Return each field of a ROW column as its own column, named column.field">
+              <Switch id={`${props.query.refId}-flatten-rows`} onChange={onFlattenRowsChange} value={query.flattenRows} />
+            </EditorField>
+            <EditorField label="Arrays" tooltip="Return the elements of ARRAY columns as rows or columns">
+              <Select
+                inputId={`${props.query.refId}-explode-arrays`}
+                options={SelectableArrayModes}
+                value={query.explodeArrays || ArrayModes.Default}
+                onChange={onArrayModeChange}
+                className="width-8"
+                menuShouldPortal={true}
+              />
+            </EditorField>
+          </EditorFieldGroup>
+          <EditorFieldGroup>
+            <EditorField
+              label="Time shift"
+              tooltip="Query an earlier period, for example 7d, and show it over the current time range"
+            >
+              <Input
+                id={`${props.query.refId}-time-shift`}
+                placeholder="7d"
+                defaultValue={query.timeShift}
+                onBlur={onTimeShiftChange}
+                width={10}
+              />
+            </EditorField>
+          </EditorFieldGroup>
           <EditorFieldGroup>
             <EditorField
               label="Format as"
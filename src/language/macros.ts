@@ -8,25 +8,28 @@ export const MACROS = [
     id: '$__timeFilter',
     name: '$__timeFilter',
     text: '$__timeFilter',
-    args: [],
+    args: ['column', 'timezone'],
     type: MacroType.Filter,
-    description: 'Will be replaced by an expression that limits the time to the dashboard range.',
+    description:
+      'Will be replaced by an expression that limits the time to the dashboard range. The optional column defaults to time, the optional timezone is for columns holding local times.',
   },
   {
     id: '$__timeFrom',
     name: '$__timeFrom',
     text: '$__timeFrom',
-    args: [],
+    args: ['format'],
     type: MacroType.Filter,
-    description: 'Will be replaced by the number in milliseconds at the start of the dashboard range',
+    description:
+      'Will be replaced by the start of the dashboard range, in milliseconds or in the optional format (s, ns or iso).',
   },
   {
     id: '$__timeTo',
     name: '$__timeTo',
     text: '$__timeTo',
-    args: [],
+    args: ['format'],
     type: MacroType.Filter,
-    description: 'Will be replaced by the number in milliseconds at the end of the dashboard range.',
+    description:
+      'Will be replaced by the end of the dashboard range, in milliseconds or in the optional format (s, ns or iso).',
   },
   {
     id: '$__interval_ms',
@@ -46,6 +49,81 @@ export const MACROS = [
     description:
       'Will be replaced by the number in milliseconds that represents the amount of time a single pixel in the graph should cover.',
   },
+  {
+    id: '$__rate_interval',
+    name: '$__rate_interval',
+    text: '$__rate_interval',
+    args: [],
+    type: MacroType.Filter,
+    description:
+      'Will be replaced by an interval long enough to hold several points, max($__interval + scrape interval, 4 * scrape interval). The scrape interval is the data source minimum interval, or 15s.',
+  },
+  {
+    id: '$__timeGroup',
+    name: '$__timeGroup',
+    text: '$__timeGroup',
+    args: ['column', 'interval', 'fill'],
+    type: MacroType.Group,
+    description:
+      'Will be replaced by a bin() expression that groups the column by interval. The optional fill (null, previous, linear or a number) fills buckets without data.',
+  },
+  {
+    id: '$__timeFilterShift',
+    name: '$__timeFilterShift',
+    text: '$__timeFilterShift',
+    args: ['column', 'shift'],
+    type: MacroType.Filter,
+    description: 'Like $__timeFilter, for the dashboard range moved back by the shift (for example 7d).',
+  },
+  {
+    id: '$__timeFromShift',
+    name: '$__timeFromShift',
+    text: '$__timeFromShift',
+    args: ['shift'],
+    type: MacroType.Filter,
+    description: 'Will be replaced by the start of the dashboard range moved back by the shift, in milliseconds.',
+  },
+  {
+    id: '$__timeToShift',
+    name: '$__timeToShift',
+    text: '$__timeToShift',
+    args: ['shift'],
+    type: MacroType.Filter,
+    description: 'Will be replaced by the end of the dashboard range moved back by the shift, in milliseconds.',
+  },
+  {
+    id: '$__timezone',
+    name: '$__timezone',
+    text: '$__timezone',
+    args: [],
+    type: MacroType.Value,
+    description: 'Will be replaced by the dashboard timezone, for example Europe/Berlin.',
+  },
+  {
+    id: '$__in',
+    name: '$__in',
+    text: '$__in',
+    args: ['column', 'variable'],
+    type: MacroType.Filter,
+    description:
+      'Will be replaced by an IN list of the variable values, or TRUE when the variable custom all value ($__all) is selected.',
+  },
+  {
+    id: '$__dimensionFilter',
+    name: '$__dimensionFilter',
+    text: '$__dimensionFilter',
+    args: ['dimension', 'variable'],
+    type: MacroType.Filter,
+    description: 'Like $__in, with the dimension name quoted as an identifier.',
+  },
+  {
+    id: '$__adhocFilters',
+    name: '$__adhocFilters',
+    text: '$__adhocFilters',
+    args: [],
+    type: MacroType.Filter,
+    description: 'Replaced by the dashboard ad hoc filters, each starting with AND, or by nothing.',
+  },
   {
     id: DATABASE_MACRO,
     name: DATABASE_MACRO,
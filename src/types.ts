@@ -1,5 +1,5 @@
 import { AwsAuthDataSourceJsonData, AwsAuthDataSourceSecureJsonData } from '@grafana/aws-sdk';
-import { DataSourceSettings, SelectableValue } from '@grafana/data';
+import { AdHocVariableFilter, DataFrameJSON, DataSourceSettings, SelectableValue } from '@grafana/data';
 import { type DataQuery } from '@grafana/schema';
 
 export interface ColumnInfo {
@@ -27,6 +27,8 @@ export enum DataType {
 export enum FormatOptions {
   Table,
   TimeSeries,
+  TimeSeriesWide,
+  TimeSeriesLong,
 }
 
 export const SelectableFormatOptions: Array<SelectableValue<FormatOptions>> = [
@@ -38,6 +40,46 @@ export const SelectableFormatOptions: Array<SelectableValue<FormatOptions>> = [
     label: 'Time Series',
     value: FormatOptions.TimeSeries,
   },
+  {
+    label: 'Time Series (wide)',
+    value: FormatOptions.TimeSeriesWide,
+    description: 'One frame with a shared time column and a column for each series',
+  },
+  {
+    label: 'Time Series (long)',
+    value: FormatOptions.TimeSeriesLong,
+    description: 'One frame with a row for each point and a column for each dimension',
+  },
+];
+
+export enum ArrayModes {
+  Default = '',
+  JSON = 'json',
+  Rows = 'rows',
+  Fields = 'fields',
+}
+
+export const SelectableArrayModes: Array<SelectableValue<ArrayModes>> = [
+  {
+    label: 'Default',
+    value: ArrayModes.Default,
+    description: 'Use the data source setting, JSON when it is not set',
+  },
+  {
+    label: 'JSON',
+    value: ArrayModes.JSON,
+    description: 'Return each array as JSON text',
+  },
+  {
+    label: 'Rows',
+    value: ArrayModes.Rows,
+    description: 'Return a row for each element, like UNNEST',
+  },
+  {
+    label: 'Fields',
+    value: ArrayModes.Fields,
+    description: 'Return a column for each index, for arrays of a fixed length',
+  },
 ];
 
 export interface MeasureInfo {
@@ -56,21 +98,42 @@ export interface TimestreamCustomMeta {
   queryId: string;
   nextToken?: string;
   hasSeries?: boolean;
+  cacheHit?: boolean;
+  deduplicated?: boolean;
+  retries?: number;
 
   executionStartTime?: number; // The backend clock
   executionFinishTime?: number; // The backend clock
 
-  fetchStartTime?: number; // The frontend clock
-  fetchEndTime?: number; // The frontend clock
-  fetchTime?: number; // The frontend clock
-
   status: {
     CumulativeBytesMetered?: number;
     CumulativeBytesScanned?: number;
   };
 
-  // when multiple queries exist we keep track of each request
-  subs?: TimestreamCustomMeta[];
+  // Totals over every page read by the backend for this response
+  stats?: {
+    bytesScanned: number;
+    bytesMetered: number;
+    pages: number;
+    rows: number;
+    durationMs: number;
+  };
+
+  // Channel streaming the remaining pages
+  stream?: TimestreamStream;
+}
+
+// A Grafana Live channel following the next token of a query, subscribed with its data
+export interface TimestreamStream {
+  path: string;
+  data: string;
+}
+
+// A message on a stream channel
+export interface StreamPage {
+  frames?: DataFrameJSON[];
+  error?: string;
+  done: boolean;
 }
 
 export interface TimestreamQuery extends DataQuery {
@@ -85,6 +148,29 @@ export interface TimestreamQuery extends DataQuery {
   // Avoid pagination
   waitForResult?: boolean;
 
+  // Stop waiting for pages once a limit is reached
+  maxRows?: number;
+  maxPages?: number;
+  maxResultBytes?: number;
+
+  // Dashboard timezone, set for each request
+  timezone?: string;
+
+  // Query an earlier period and move the results forward, for example "7d"
+  timeShift?: string;
+
+  // Overrides the data source query timeout, for example "2m"
+  queryTimeout?: string;
+
+  // Dashboard ad hoc filters, set for each request
+  adhocFilters?: AdHocVariableFilter[];
+
+  // Return the fields of ROW columns as separate columns
+  flattenRows?: boolean;
+
+  // Return the elements of ARRAY columns as rows or columns
+  explodeArrays?: ArrayModes;
+
   format?: FormatOptions;
 
   // Not a real parameter...
@@ -95,6 +181,20 @@ export interface TimestreamOptions extends AwsAuthDataSourceJsonData {
   defaultDatabase?: string;
   defaultTable?: string;
   defaultMeasure?: string;
+
+  // Backend query execution
+  maxConcurrentQueries?: number;
+  cacheTTL?: string;
+  cacheMaxEntries?: number;
+  maxRows?: number;
+  maxPages?: number;
+  maxResultBytes?: number;
+  maxRetries?: number;
+  queryTimeout?: string;
+  minInterval?: string;
+  intervalRounding?: string[];
+  macros?: Record<string, string>;
+  intervalsAsStrings?: boolean;
 }
 
 export interface TimestreamSecureJsonData extends AwsAuthDataSourceSecureJsonData {